@@ -21,7 +21,9 @@ func init() {
 	}
 }
 
-var RS_BLOCK_OFFSET = map[int]int{
+// RS_BLOCK_OFFSET maps an error correction level to its row among the four
+// rows of each version in RS_BLOCK_TABLE and MICRO_RS_BLOCK_TABLE.
+var RS_BLOCK_OFFSET = map[constants.ErrorCorrectionLevel]int{
 	constants.ERROR_CORRECT_L: 0,
 	constants.ERROR_CORRECT_M: 1,
 	constants.ERROR_CORRECT_Q: 2,
@@ -177,10 +179,13 @@ type RSBlock struct {
 	DataCount  int
 }
 
-func RSBlocks(version int, errorCorrection int) ([]RSBlock, error) {
+func RSBlocks(version int, errorCorrection constants.ErrorCorrectionLevel) ([]RSBlock, error) {
 	offset, ok := RS_BLOCK_OFFSET[errorCorrection]
 	if !ok {
-		return nil, fmt.Errorf("bad rs block @ version: %d / error_correction: %d", version, errorCorrection)
+		return nil, fmt.Errorf("%w (%d)", constants.ErrInvalidErrorCorrection, int(errorCorrection))
+	}
+	if version < 1 || version > 40 {
+		return nil, fmt.Errorf("bad rs block @ version: %d / error_correction: %s", version, errorCorrection)
 	}
 	rsBlock := RS_BLOCK_TABLE[(version-1)*4+offset]
 
@@ -196,3 +201,90 @@ func RSBlocks(version int, errorCorrection int) ([]RSBlock, error) {
 
 	return blocks, nil
 }
+
+// MICRO_RS_BLOCK_TABLE holds the Micro QR block layout of versions M1-M4,
+// indexed like RS_BLOCK_TABLE. Empty entries are unsupported levels.
+var MICRO_RS_BLOCK_TABLE = [][]int{
+	{1, 5, 3}, {}, {}, {},
+	{1, 10, 5}, {1, 10, 4}, {}, {},
+	{1, 17, 11}, {1, 17, 9}, {}, {},
+	{1, 24, 16}, {1, 24, 14}, {1, 24, 10}, {},
+}
+
+func MicroRSBlocks(version int, errorCorrection constants.ErrorCorrectionLevel) ([]RSBlock, error) {
+	offset, ok := RS_BLOCK_OFFSET[errorCorrection]
+	if !ok {
+		return nil, fmt.Errorf("%w (%d)", constants.ErrInvalidErrorCorrection, int(errorCorrection))
+	}
+	if version < 1 || version > 4 || len(MICRO_RS_BLOCK_TABLE[(version-1)*4+offset]) == 0 {
+		return nil, fmt.Errorf("bad rs block @ micro version: M%d / error_correction: %s", version, errorCorrection)
+	}
+	rsBlock := MICRO_RS_BLOCK_TABLE[(version-1)*4+offset]
+
+	return []RSBlock{{TotalCount: rsBlock[1], DataCount: rsBlock[2]}}, nil
+}
+
+var RMQR_RS_BLOCK_OFFSET = map[constants.ErrorCorrectionLevel]int{
+	constants.ERROR_CORRECT_M: 0,
+	constants.ERROR_CORRECT_H: 1,
+}
+
+// RMQR_RS_BLOCK_TABLE holds the rMQR block layout of versions R7x43-R17x139,
+// two rows per version for error correction levels M and H.
+var RMQR_RS_BLOCK_TABLE = [][]int{
+	{1, 13, 6}, {1, 13, 3},
+	{1, 21, 12}, {1, 21, 7},
+	{1, 32, 20}, {1, 32, 10},
+	{1, 44, 28}, {1, 44, 14},
+	{1, 68, 44}, {2, 34, 12},
+	{1, 21, 12}, {1, 21, 7},
+	{1, 33, 21}, {1, 33, 11},
+	{1, 49, 31}, {1, 24, 8, 1, 25, 9},
+	{1, 66, 42}, {2, 33, 11},
+	{1, 49, 31, 1, 50, 32}, {3, 33, 11},
+	{1, 15, 7}, {1, 15, 5},
+	{1, 31, 19}, {1, 31, 11},
+	{1, 47, 31}, {1, 23, 7, 1, 24, 8},
+	{1, 67, 43}, {1, 33, 11, 1, 34, 12},
+	{1, 44, 28, 1, 45, 29}, {1, 44, 14, 1, 45, 15},
+	{2, 66, 42}, {3, 44, 14},
+	{1, 21, 12}, {1, 21, 7},
+	{1, 41, 27}, {1, 41, 13},
+	{1, 60, 38}, {2, 30, 10},
+	{1, 42, 26, 1, 43, 27}, {1, 42, 14, 1, 43, 15},
+	{1, 56, 36, 1, 57, 37}, {1, 37, 11, 2, 38, 12},
+	{2, 55, 35, 1, 56, 36}, {2, 41, 13, 2, 42, 14},
+	{1, 51, 33}, {1, 25, 7, 1, 26, 8},
+	{1, 74, 48}, {2, 37, 13},
+	{1, 51, 33, 1, 52, 34}, {2, 34, 10, 1, 35, 11},
+	{2, 68, 44}, {4, 34, 12},
+	{2, 66, 42, 1, 67, 43}, {1, 39, 13, 4, 40, 14},
+	{1, 61, 39}, {1, 30, 10, 1, 31, 11},
+	{2, 44, 28}, {2, 44, 14},
+	{2, 61, 39}, {1, 40, 12, 2, 41, 13},
+	{2, 53, 33, 1, 54, 34}, {4, 40, 14},
+	{4, 58, 38}, {2, 38, 12, 4, 39, 13},
+}
+
+func RMQRRSBlocks(version int, errorCorrection constants.ErrorCorrectionLevel) ([]RSBlock, error) {
+	if !errorCorrection.Valid() {
+		return nil, fmt.Errorf("%w (%d)", constants.ErrInvalidErrorCorrection, int(errorCorrection))
+	}
+	offset, ok := RMQR_RS_BLOCK_OFFSET[errorCorrection]
+	if !ok || version < 1 || version > len(RMQR_RS_BLOCK_TABLE)/2 {
+		return nil, fmt.Errorf("bad rs block @ rmqr version: %d / error_correction: %s", version, errorCorrection)
+	}
+	rsBlock := RMQR_RS_BLOCK_TABLE[(version-1)*2+offset]
+
+	var blocks []RSBlock
+	for i := 0; i < len(rsBlock); i += 3 {
+		count := rsBlock[i]
+		totalCount := rsBlock[i+1]
+		dataCount := rsBlock[i+2]
+		for j := 0; j < count; j++ {
+			blocks = append(blocks, RSBlock{TotalCount: totalCount, DataCount: dataCount})
+		}
+	}
+
+	return blocks, nil
+}
@@ -0,0 +1,103 @@
+package base
+
+import (
+	"fmt"
+	"sync"
+)
+
+// generatorCache holds the generator polynomials by error correction
+// codeword count, as the logarithms of their coefficients. Zero coefficients,
+// which have no logarithm, are stored as -1.
+var (
+	generatorMu    sync.Mutex
+	generatorCache = make(map[int][]int)
+)
+
+func gfMul(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return EXP_TABLE[(LOG_TABLE[a]+LOG_TABLE[b])%255]
+}
+
+// RSGenerator returns the coefficients of the Reed-Solomon generator
+// polynomial (x - α^0)(x - α^1)...(x - α^(ecCount-1)), highest degree first.
+// The leading coefficient, which is always 1, is left out.
+func RSGenerator(ecCount int) ([]byte, error) {
+	logs, err := generatorLogs(ecCount)
+	if err != nil {
+		return nil, err
+	}
+	coefficients := make([]byte, len(logs))
+	for i, l := range logs {
+		if l >= 0 {
+			coefficients[i] = byte(Gexp(l))
+		}
+	}
+	return coefficients, nil
+}
+
+// generatorLogs returns the logarithms of the generator polynomial
+// coefficients, computing and caching them on first use.
+func generatorLogs(ecCount int) ([]int, error) {
+	if ecCount < 1 || ecCount > 254 {
+		return nil, fmt.Errorf("invalid error correction codeword count (%d)", ecCount)
+	}
+
+	generatorMu.Lock()
+	defer generatorMu.Unlock()
+	if logs, ok := generatorCache[ecCount]; ok {
+		return logs, nil
+	}
+
+	poly := []int{1}
+	for i := 0; i < ecCount; i++ {
+		// Multiply by (x - α^i), which is (x + α^i) in GF(256).
+		next := make([]int, len(poly)+1)
+		for j, c := range poly {
+			next[j] ^= c
+			next[j+1] ^= gfMul(c, Gexp(i))
+		}
+		poly = next
+	}
+
+	logs := make([]int, ecCount)
+	for i, c := range poly[1:] {
+		logs[i] = -1
+		if c != 0 {
+			logs[i] = LOG_TABLE[c]
+		}
+	}
+	generatorCache[ecCount] = logs
+	return logs, nil
+}
+
+// RSEncode returns the ecCount Reed-Solomon error correction codewords of data.
+func RSEncode(data []byte, ecCount int) ([]byte, error) {
+	logs, err := generatorLogs(ecCount)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)+ecCount > 255 {
+		return nil, fmt.Errorf("RS block too long (%d data + %d error correction codewords)", len(data), ecCount)
+	}
+
+	// Divide by the generator polynomial with a linear feedback shift
+	// register, leaving the remainder in ec.
+	ec := make([]byte, ecCount)
+	for _, d := range data {
+		factor := d ^ ec[0]
+		copy(ec, ec[1:])
+		ec[ecCount-1] = 0
+		if factor == 0 {
+			continue
+		}
+		factorLog := LOG_TABLE[factor]
+		for i, l := range logs {
+			if l >= 0 {
+				ec[i] ^= byte(EXP_TABLE[(factorLog+l)%255])
+			}
+		}
+	}
+	return ec, nil
+}
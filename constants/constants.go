@@ -1,8 +1,114 @@
 package constants
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrorCorrectionLevel is a QR Code error correction level. The levels are
+// numbered from the lowest to the highest recovery capacity, starting at 1,
+// so the zero value is invalid. FormatBits returns the value encoded in the
+// symbol.
+type ErrorCorrectionLevel int
+
 const (
-	ERROR_CORRECT_L = 1
-	ERROR_CORRECT_M = 0
-	ERROR_CORRECT_Q = 3
-	ERROR_CORRECT_H = 2
+	ERROR_CORRECT_L ErrorCorrectionLevel = iota + 1
+	ERROR_CORRECT_M
+	ERROR_CORRECT_Q
+	ERROR_CORRECT_H
 )
+
+// ErrInvalidErrorCorrection is matched by errors about unknown or unsupported
+// error correction levels.
+var ErrInvalidErrorCorrection = errors.New("invalid error correction level")
+
+var errorCorrectionNames = map[ErrorCorrectionLevel]string{
+	ERROR_CORRECT_L: "L",
+	ERROR_CORRECT_M: "M",
+	ERROR_CORRECT_Q: "Q",
+	ERROR_CORRECT_H: "H",
+}
+
+// errorCorrectionFormatBits holds the two bit value that identifies each
+// level in the format information.
+var errorCorrectionFormatBits = map[ErrorCorrectionLevel]int{
+	ERROR_CORRECT_L: 1,
+	ERROR_CORRECT_M: 0,
+	ERROR_CORRECT_Q: 3,
+	ERROR_CORRECT_H: 2,
+}
+
+// errorCorrectionRecovery holds the approximate share of codewords, in
+// percent, each level can restore.
+var errorCorrectionRecovery = map[ErrorCorrectionLevel]int{
+	ERROR_CORRECT_L: 7,
+	ERROR_CORRECT_M: 15,
+	ERROR_CORRECT_Q: 25,
+	ERROR_CORRECT_H: 30,
+}
+
+// ParseErrorCorrectionLevel parses a level name, "L", "M", "Q" or "H", in
+// either case.
+func ParseErrorCorrectionLevel(s string) (ErrorCorrectionLevel, error) {
+	name := strings.ToUpper(strings.TrimSpace(s))
+	for level, n := range errorCorrectionNames {
+		if n == name {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrInvalidErrorCorrection, s)
+}
+
+// Valid reports whether l is one of the four levels.
+func (l ErrorCorrectionLevel) Valid() bool {
+	_, ok := errorCorrectionNames[l]
+	return ok
+}
+
+func (l ErrorCorrectionLevel) String() string {
+	if name, ok := errorCorrectionNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorCorrectionLevel(%d)", int(l))
+}
+
+// FormatBits returns the two bit value that identifies the level in the
+// format information, or -1 for an invalid level.
+func (l ErrorCorrectionLevel) FormatBits() int {
+	if bits, ok := errorCorrectionFormatBits[l]; ok {
+		return bits
+	}
+	return -1
+}
+
+// Index returns the position of the level in tables ordered L, M, Q, H, such
+// as the Reed-Solomon block table, or -1 for an invalid level.
+func (l ErrorCorrectionLevel) Index() int {
+	if !l.Valid() {
+		return -1
+	}
+	return int(l - ERROR_CORRECT_L)
+}
+
+// RecoveryPercent returns the approximate share of codewords, in percent, the
+// level can restore, or 0 for an invalid level.
+func (l ErrorCorrectionLevel) RecoveryPercent() int {
+	return errorCorrectionRecovery[l]
+}
+
+func (l ErrorCorrectionLevel) MarshalText() ([]byte, error) {
+	if !l.Valid() {
+		return nil, fmt.Errorf("%w (%d)", ErrInvalidErrorCorrection, int(l))
+	}
+	return []byte(errorCorrectionNames[l]), nil
+}
+
+func (l *ErrorCorrectionLevel) UnmarshalText(text []byte) error {
+	level, err := ParseErrorCorrectionLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
@@ -0,0 +1,237 @@
+// Package encryption seals QR payloads with AES-256-GCM, so only holders of
+// the key or password can read them. An envelope is laid out as
+//
+//	version (1 byte) | flags (1 byte) |
+//	[PBKDF2 iterations (uvarint) | salt (16 bytes)] | nonce (12 bytes) |
+//	ciphertext | tag (16 bytes)
+//
+// The bracketed fields are present for password envelopes only. Everything
+// before the nonce is authenticated along with the ciphertext. The overhead
+// is 30 bytes with a raw key. With a password it is 46 bytes plus the
+// iteration count, which takes 3 bytes at DefaultIterations for a total of
+// 49, and 2 bytes for counts from 128 to 16383.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"qrcode/utils"
+)
+
+// envelopeVersion is the version of the envelope layout.
+const envelopeVersion = 1
+
+const (
+	flagPassword = 1 << iota
+	flagCompressed
+)
+
+const (
+	// KeySize is the size of a raw AES-256 key.
+	KeySize = 32
+	// DefaultIterations is the PBKDF2 iteration count of password envelopes.
+	DefaultIterations = 600000
+	// MaxIterations is the largest iteration count Open accepts, so a crafted
+	// envelope cannot make it spin for minutes.
+	MaxIterations = 10000000
+	// MaxPlaintextSize limits the plaintext Open inflates from compressed
+	// envelopes.
+	MaxPlaintextSize = 1 << 20
+
+	saltSize = 16
+)
+
+// ErrDecryption is returned, possibly wrapped, for envelopes that are
+// malformed, were altered or do not match the secret.
+var ErrDecryption = errors.New("decryption failed")
+
+// Secret is a raw key or a password to derive the key from.
+type Secret struct {
+	key        []byte
+	password   []byte
+	iterations int
+}
+
+// Key returns a Secret holding a raw KeySize byte key.
+func Key(key []byte) Secret {
+	return Secret{key: append([]byte(nil), key...)}
+}
+
+// Password returns a Secret that derives the key from password with
+// PBKDF2-HMAC-SHA256 and DefaultIterations.
+func Password(password string) Secret {
+	return Secret{password: []byte(password), iterations: DefaultIterations}
+}
+
+// WithIterations returns a copy of a password Secret that seals with the
+// given PBKDF2 iteration count. Open reads the count from the envelope.
+func (s Secret) WithIterations(iterations int) Secret {
+	s.iterations = iterations
+	return s
+}
+
+func (s Secret) isPassword() bool {
+	return s.password != nil
+}
+
+func (s Secret) check() error {
+	if s.isPassword() {
+		if len(s.password) == 0 {
+			return fmt.Errorf("empty password")
+		}
+		return nil
+	}
+	if len(s.key) != KeySize {
+		return fmt.Errorf("invalid key size (%d bytes, want %d)", len(s.key), KeySize)
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveKey derives the AES key of a password envelope with
+// PBKDF2-HMAC-SHA256 (RFC 8018).
+func deriveKey(password, salt []byte, iterations int) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, string(password), salt, iterations, KeySize)
+}
+
+// Seal encrypts plaintext into an envelope. With compress, the plaintext is
+// deflated first; Open inflates it again.
+func Seal(plaintext []byte, secret Secret, compress bool) ([]byte, error) {
+	if err := secret.check(); err != nil {
+		return nil, err
+	}
+	if secret.isPassword() && (secret.iterations < 1 || secret.iterations > MaxIterations) {
+		return nil, fmt.Errorf("invalid iteration count (%d)", secret.iterations)
+	}
+
+	var flags byte
+	if compress {
+		flags |= flagCompressed
+		compressed, err := utils.Deflate(plaintext)
+		if err != nil {
+			return nil, err
+		}
+		plaintext = compressed
+	}
+
+	key := secret.key
+	header := []byte{envelopeVersion, 0}
+	if secret.isPassword() {
+		flags |= flagPassword
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		header = binary.AppendUvarint(header, uint64(secret.iterations))
+		header = append(header, salt...)
+		var err error
+		if key, err = deriveKey(secret.password, salt, secret.iterations); err != nil {
+			return nil, err
+		}
+	}
+	header[1] = flags
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	envelope := append(header, nonce...)
+	return aead.Seal(envelope, nonce, plaintext, header), nil
+}
+
+// SealText encrypts plaintext into an envelope encoded as Base45 text, which
+// fits an alphanumeric segment.
+func SealText(plaintext []byte, secret Secret, compress bool) (string, error) {
+	envelope, err := Seal(plaintext, secret, compress)
+	if err != nil {
+		return "", err
+	}
+	return utils.Base45Encode(envelope), nil
+}
+
+// Open decrypts an envelope created by Seal. Errors about the envelope
+// match ErrDecryption.
+func Open(envelope []byte, secret Secret) ([]byte, error) {
+	if err := secret.check(); err != nil {
+		return nil, err
+	}
+
+	if len(envelope) < 2 {
+		return nil, fmt.Errorf("%w: truncated envelope", ErrDecryption)
+	}
+	if envelope[0] != envelopeVersion {
+		return nil, fmt.Errorf("%w: unknown envelope version %d", ErrDecryption, envelope[0])
+	}
+	flags := envelope[1]
+	if flags&^(flagPassword|flagCompressed) != 0 {
+		return nil, fmt.Errorf("%w: unknown flags %#x", ErrDecryption, flags)
+	}
+	if (flags&flagPassword != 0) != secret.isPassword() {
+		return nil, fmt.Errorf("%w: envelope and secret disagree on password use", ErrDecryption)
+	}
+
+	key := secret.key
+	offset := 2
+	if flags&flagPassword != 0 {
+		iterations, n := binary.Uvarint(envelope[offset:])
+		if n <= 0 || iterations < 1 || iterations > MaxIterations {
+			return nil, fmt.Errorf("%w: invalid iteration count", ErrDecryption)
+		}
+		offset += n
+		if len(envelope) < offset+saltSize {
+			return nil, fmt.Errorf("%w: truncated envelope", ErrDecryption)
+		}
+		salt := envelope[offset : offset+saltSize]
+		offset += saltSize
+		var err error
+		if key, err = deriveKey(secret.password, salt, int(iterations)); err != nil {
+			return nil, err
+		}
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope) < offset+aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("%w: truncated envelope", ErrDecryption)
+	}
+	header := envelope[:offset]
+	nonce := envelope[offset : offset+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, envelope[offset+aead.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: wrong secret or altered envelope", ErrDecryption)
+	}
+
+	if flags&flagCompressed != 0 {
+		return utils.Inflate(plaintext, MaxPlaintextSize)
+	}
+	return plaintext, nil
+}
+
+// OpenText decrypts an envelope created by SealText.
+func OpenText(text string, secret Secret) ([]byte, error) {
+	envelope, err := utils.Base45Decode(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecryption, err)
+	}
+	return Open(envelope, secret)
+}
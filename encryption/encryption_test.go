@@ -0,0 +1,176 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testIterations keeps password tests fast. Its uvarint takes 2 bytes.
+const testIterations = 1000
+
+var testPlaintext = []byte(strings.Repeat("encrypted QR payload ", 8))
+
+type testSecret struct {
+	name   string
+	secret Secret
+}
+
+func testSecrets() []testSecret {
+	return []testSecret{
+		{"key", Key(bytes.Repeat([]byte{3}, KeySize))},
+		{"password", Password("correct horse battery staple").WithIterations(testIterations)},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tt := range testSecrets() {
+		for _, compress := range []bool{false, true} {
+			for _, plaintext := range [][]byte{testPlaintext, {}} {
+				envelope, err := Seal(plaintext, tt.secret, compress)
+				if err != nil {
+					t.Fatalf("%s: Seal: %v", tt.name, err)
+				}
+				got, err := Open(envelope, tt.secret)
+				if err != nil {
+					t.Fatalf("%s: Open: %v", tt.name, err)
+				}
+				if !bytes.Equal(got, plaintext) {
+					t.Errorf("%s, compress %v: got %q, want %q", tt.name, compress, got, plaintext)
+				}
+
+				text, err := SealText(plaintext, tt.secret, compress)
+				if err != nil {
+					t.Fatalf("%s: SealText: %v", tt.name, err)
+				}
+				if got, err = OpenText(text, tt.secret); err != nil {
+					t.Fatalf("%s: OpenText: %v", tt.name, err)
+				}
+				if !bytes.Equal(got, plaintext) {
+					t.Errorf("%s, compress %v: got text %q, want %q", tt.name, compress, got, plaintext)
+				}
+			}
+		}
+	}
+
+	// Sealing twice uses a fresh nonce and salt.
+	for _, tt := range testSecrets() {
+		a, _ := Seal(testPlaintext, tt.secret, false)
+		b, _ := Seal(testPlaintext, tt.secret, false)
+		if bytes.Equal(a, b) {
+			t.Errorf("%s: two envelopes of the same plaintext are equal", tt.name)
+		}
+	}
+}
+
+func TestOverhead(t *testing.T) {
+	tests := []struct {
+		secret Secret
+		want   int
+	}{
+		{Key(bytes.Repeat([]byte{3}, KeySize)), 30},
+		{Password("pw").WithIterations(testIterations), 48},
+		{Password("pw"), 49},
+	}
+	for _, tt := range tests {
+		envelope, err := Seal(testPlaintext, tt.secret, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(envelope) - len(testPlaintext); got != tt.want {
+			t.Errorf("iterations %d: overhead %d bytes, want %d", tt.secret.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestTampered(t *testing.T) {
+	for _, tt := range testSecrets() {
+		envelope, err := Seal(testPlaintext, tt.secret, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range envelope {
+			tampered := append([]byte(nil), envelope...)
+			tampered[i] ^= 0x01
+			if _, err := Open(tampered, tt.secret); !errors.Is(err, ErrDecryption) {
+				t.Errorf("%s: byte %d flipped: got %v, want ErrDecryption", tt.name, i, err)
+			}
+		}
+		if _, err := Open(append(envelope, 0), tt.secret); !errors.Is(err, ErrDecryption) {
+			t.Errorf("%s: extended: got %v, want ErrDecryption", tt.name, err)
+		}
+		if _, err := OpenText("not base45!", tt.secret); !errors.Is(err, ErrDecryption) {
+			t.Errorf("%s: invalid text: got %v, want ErrDecryption", tt.name, err)
+		}
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	for _, tt := range testSecrets() {
+		envelope, err := Seal(testPlaintext, tt.secret, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n := 0; n < len(envelope); n++ {
+			if _, err := Open(envelope[:n], tt.secret); !errors.Is(err, ErrDecryption) {
+				t.Errorf("%s: truncated to %d bytes: got %v, want ErrDecryption", tt.name, n, err)
+			}
+		}
+	}
+}
+
+func TestWrongSecret(t *testing.T) {
+	key := Key(bytes.Repeat([]byte{3}, KeySize))
+	password := Password("correct horse battery staple").WithIterations(testIterations)
+	tests := []struct {
+		name       string
+		seal, open Secret
+	}{
+		{"other key", key, Key(bytes.Repeat([]byte{4}, KeySize))},
+		{"other password", password, Password("correct horse battery stapler")},
+		{"password for key", key, password},
+		{"key for password", password, key},
+	}
+	for _, tt := range tests {
+		envelope, err := Seal(testPlaintext, tt.seal, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Open(envelope, tt.open); !errors.Is(err, ErrDecryption) {
+			t.Errorf("%s: got %v, want ErrDecryption", tt.name, err)
+		}
+	}
+}
+
+func TestInvalidSecret(t *testing.T) {
+	for _, secret := range []Secret{Key(make([]byte, 16)), Password(""), Password("pw").WithIterations(0), Password("pw").WithIterations(MaxIterations + 1)} {
+		if _, err := Seal(testPlaintext, secret, false); err == nil {
+			t.Errorf("Seal accepted %+v", secret)
+		}
+	}
+}
+
+// TestDeriveKey checks the first KeySize bytes of the PBKDF2-HMAC-SHA256 test
+// vectors of RFC 7914 section 11.
+func TestDeriveKey(t *testing.T) {
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56"},
+	}
+	for _, tt := range tests {
+		got, err := deriveKey([]byte(tt.password), []byte(tt.salt), tt.iterations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("deriveKey(%q, %q, %d) = %x, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
@@ -1,3 +1,5 @@
 module qrcode
 
-go 1.22.7
+go 1.24.0
+
+require golang.org/x/text v0.22.0
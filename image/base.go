@@ -2,11 +2,12 @@ package image
 
 import (
 	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/png"
-	"os"
+	"io"
 	"qrcode/image/styles/moduledrawers"
 	"qrcode/utils"
 	"strings"
@@ -20,9 +21,12 @@ type BaseImage struct {
 	NeedsDrawRect   bool
 	border          int
 	width           int
+	height          int
 	boxSize         int
-	pixelSize       int
+	pixelWidth      int
+	pixelHeight     int
 	modules         [][]bool
+	roles           *utils.RoleMap
 	img             image.Image
 }
 
@@ -40,13 +44,21 @@ type DrawerAlias struct {
 }
 
 func NewBaseImage(border int, width int, boxSize int, modules [][]bool) *BaseImage {
-	pixelSize := (width + border*2) * boxSize
-	img := image.NewRGBA(image.Rect(0, 0, pixelSize, pixelSize))
+	return NewRectBaseImage(border, width, width, boxSize, modules)
+}
+
+// NewRectBaseImage creates a BaseImage for a symbol that is not square.
+func NewRectBaseImage(border int, width int, height int, boxSize int, modules [][]bool) *BaseImage {
+	pixelWidth := (width + border*2) * boxSize
+	pixelHeight := (height + border*2) * boxSize
+	img := image.NewRGBA(image.Rect(0, 0, pixelWidth, pixelHeight))
 	return &BaseImage{
 		border:        border,
 		width:         width,
+		height:        height,
 		boxSize:       boxSize,
-		pixelSize:     pixelSize,
+		pixelWidth:    pixelWidth,
+		pixelHeight:   pixelHeight,
 		modules:       modules,
 		img:           img,
 		NeedsDrawRect: true,
@@ -76,7 +88,7 @@ func (bi *BaseImage) PixelBox(row, col int) (image.Point, image.Point) {
 }
 
 func (bi *BaseImage) NewImage() image.Image {
-	return image.NewRGBA(image.Rect(0, 0, bi.pixelSize, bi.pixelSize))
+	return image.NewRGBA(image.Rect(0, 0, bi.pixelWidth, bi.pixelHeight))
 }
 
 func (bi *BaseImage) InitNewImage() {
@@ -104,8 +116,28 @@ func (bi *BaseImage) CheckKind(kind *string, transform func(string) string) (str
 	return *kind, nil
 }
 
+// SetRoleMap hands the module roles of the symbol to the image, so drawers can
+// style modules by what they are used for.
+func (bi *BaseImage) SetRoleMap(roles *utils.RoleMap) {
+	bi.roles = roles
+}
+
+// Role returns the role of the module at row, col, or utils.RoleNone if the
+// image has no role map.
+func (bi *BaseImage) Role(row, col int) utils.ModuleRole {
+	if bi.roles == nil {
+		return utils.RoleNone
+	}
+	return bi.roles.Role(row, col)
+}
+
+// IsEye reports whether the module belongs to a finder pattern. Without a
+// role map the three corner areas are assumed.
 func (bi *BaseImage) IsEye(row, col int) bool {
-	return (row < 7 && col < 7) || (row < 7 && bi.width-col < 8) || (bi.width-row < 8 && col < 7)
+	if bi.roles != nil {
+		return bi.roles.Role(row, col) == utils.RoleFinder
+	}
+	return (row < 7 && col < 7) || (row < 7 && bi.width-col < 8) || (bi.height-row < 8 && col < 7)
 }
 
 func NewBaseImageWithDrawer(
@@ -159,12 +191,20 @@ func (biwd *BaseImageWithDrawer) DrawRectContext(row, col int, qr interface{}) {
 
 type PilImage struct {
 	BaseImage
-	fillColor color.Color
-	idr       *image.RGBA
+	fillColor    color.Color
+	backColor    color.Color
+	moduleDrawer moduledrawers.QRModuleDrawer
+	eyeDrawer    moduledrawers.QRModuleDrawer
+	idr          *image.RGBA
 }
 
 func NewPilImage(border, width, boxSize int, modules [][]bool, kwargs map[string]interface{}) *PilImage {
-	img := NewBaseImage(border, width, boxSize, modules)
+	return NewRectPilImage(border, width, width, boxSize, modules, kwargs)
+}
+
+// NewRectPilImage creates a PilImage for a symbol that is not square.
+func NewRectPilImage(border, width, height, boxSize int, modules [][]bool, kwargs map[string]interface{}) *PilImage {
+	img := NewRectBaseImage(border, width, height, boxSize, modules)
 	pilImg := &PilImage{
 		BaseImage: *img,
 	}
@@ -172,48 +212,134 @@ func NewPilImage(border, width, boxSize int, modules [][]bool, kwargs map[string
 	return pilImg
 }
 
+// newImage paints the background. kwargs may set "fill_color" and
+// "back_color", either as a color.Color or as a color name.
 func (p *PilImage) newImage(kwargs map[string]interface{}) *image.RGBA {
-	backColor := color.White
-	fillColor := color.Black
+	p.fillColor = kwargColor(kwargs["fill_color"], color.Black)
+	p.backColor = kwargColor(kwargs["back_color"], color.White)
+
+	p.idr = image.NewRGBA(image.Rect(0, 0, p.pixelWidth, p.pixelHeight))
+	draw.Draw(p.idr, p.idr.Bounds(), &image.Uniform{p.backColor}, image.Point{}, draw.Src)
+	return p.idr
+}
 
-	if bc, ok := kwargs["back_color"].(string); ok {
-		backColor = parseColor(bc).(color.Gray16)
+func kwargColor(arg interface{}, fallback color.Color) color.Color {
+	switch c := arg.(type) {
+	case color.Color:
+		return c
+	case string:
+		return parseColor(c)
 	}
-	if fc, ok := kwargs["fill_color"].(string); ok {
-		fillColor = parseColor(fc).(color.Gray16)
+	return fallback
+}
+
+// SetColors changes the module and background colors and repaints the
+// background. A nil color leaves that color unchanged. Call it before
+// drawing any module.
+func (p *PilImage) SetColors(fill, back color.Color) {
+	if fill != nil {
+		p.fillColor = fill
 	}
+	if back != nil {
+		p.backColor = back
+		draw.Draw(p.idr, p.idr.Bounds(), &image.Uniform{p.backColor}, image.Point{}, draw.Src)
+	}
+}
 
-	if fillColor == color.Black && backColor == color.White {
-		fillColor = color.Black
-		backColor = color.White
-	} else if r, g, b, a := backColor.RGBA(); r == 0 && g == 0 && b == 0 && a == 0 {
-		backColor = color.Gray16{Y: 0}
-	} else {
-		backColor = color.White
+// SetDrawers makes DrawRect hand dark modules to drawers instead of filling
+// their box. eye draws the finder patterns and defaults to module when nil.
+// Both drawers are initialized with p, so they must not be drawing another
+// image at the same time.
+func (p *PilImage) SetDrawers(module, eye moduledrawers.QRModuleDrawer) {
+	if eye == nil {
+		eye = module
+	}
+	p.moduleDrawer = module
+	p.eyeDrawer = eye
+	for _, drawer := range []moduledrawers.QRModuleDrawer{module, eye} {
+		if drawer != nil {
+			drawer.Initialize(p)
+		}
 	}
+}
+
+// Canvas returns the image drawers paint on.
+func (p *PilImage) Canvas() *image.RGBA {
+	return p.idr
+}
+
+// Drawers returns the drawers set with SetDrawers, or nil if modules are
+// filled as plain boxes.
+func (p *PilImage) Drawers() (module, eye moduledrawers.QRModuleDrawer) {
+	return p.moduleDrawer, p.eyeDrawer
+}
 
-	img := image.NewRGBA(image.Rect(0, 0, p.pixelSize, p.pixelSize))
-	draw.Draw(img, img.Bounds(), &image.Uniform{backColor}, image.Point{}, draw.Src)
-	p.fillColor = fillColor
-	p.idr = img
-	return img
+func (p *PilImage) FillColor() color.Color {
+	return p.fillColor
+}
+
+func (p *PilImage) BackColor() color.Color {
+	return p.backColor
 }
 
 func (p *PilImage) DrawRect(row, col int) {
 	box := p.pixelBox(row, col)
+	drawer := p.moduleDrawer
+	if p.IsEye(row, col) {
+		drawer = p.eyeDrawer
+	}
+	if drawer != nil {
+		drawer.DrawRect(moduledrawers.Rectangle{
+			X:      box.Min.X,
+			Y:      box.Min.Y,
+			Width:  p.boxSize,
+			Height: p.boxSize,
+		}, true)
+		return
+	}
 	draw.Draw(p.idr, box, &image.Uniform{p.fillColor}, image.Point{}, draw.Src)
 }
 
-func (p *PilImage) Save(stream *os.File, format string, kwargs map[string]interface{}) error {
-	if format == "" {
+// EmbedImage draws src over the middle of the symbol, scaled to a quarter of
+// the symbol width. The covered modules must be recovered by error
+// correction, so the symbol should use ERROR_CORRECT_H.
+func (p *PilImage) EmbedImage(src image.Image) {
+	bounds := src.Bounds()
+	if bounds.Empty() {
+		return
+	}
+	width := p.width * p.boxSize / 4
+	height := width * bounds.Dy() / bounds.Dx()
+	if width == 0 || height == 0 {
+		return
+	}
+
+	x := (p.pixelWidth - width) / 2
+	y := (p.pixelHeight - height) / 2
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	for sy := 0; sy < height; sy++ {
+		for sx := 0; sx < width; sx++ {
+			scaled.Set(sx, sy, src.At(bounds.Min.X+sx*bounds.Dx()/width, bounds.Min.Y+sy*bounds.Dy()/height))
+		}
+	}
+	draw.Draw(p.idr, image.Rect(x, y, x+width, y+height), scaled, image.Point{}, draw.Over)
+}
+
+// Save writes the image to stream. Only the "png" format is supported; an
+// empty format uses the kind of the image, or png if it has none.
+func (p *PilImage) Save(stream io.Writer, format string, kwargs map[string]interface{}) error {
+	if format == "" && p.kind != nil {
 		format = *p.kind
 	}
+	if format != "" && !strings.EqualFold(format, "png") {
+		return fmt.Errorf("Unsupported image format: %s", format)
+	}
 	return png.Encode(stream, p.img)
 }
 
 func (p *PilImage) pixelBox(row, col int) image.Rectangle {
-	x := p.border + col*p.boxSize
-	y := p.border + row*p.boxSize
+	x := (col + p.border) * p.boxSize
+	y := (row + p.border) * p.boxSize
 	return image.Rect(x, y, x+p.boxSize, y+p.boxSize)
 }
 
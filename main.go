@@ -18,16 +18,16 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	q.SetVersion(4)
+	if err := q.SetVersion(4); err != nil {
+		log.Fatal(err)
+	}
 
 	data := "Hello, world!"
 
 	if err := q.AddData(data, 0); err != nil {
 		log.Fatal(err)
 	}
-	q.PrintASCII(
-		nil,
-		false,
-		false,
-	)
+	if err := q.PrintASCII(nil, false, false); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,52 @@
+package qr
+
+import (
+	"bytes"
+	"testing"
+
+	"qrcode/constants"
+	"qrcode/image"
+	"qrcode/utils"
+)
+
+func TestAddBase45(t *testing.T) {
+	q, err := NewQRCode(0, constants.ERROR_CORRECT_M, 1, 4, image.PilImage{}, MaskAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.AddData(Base45("Hello!!"), 0); err != nil {
+		t.Fatal(err)
+	}
+	// The example of RFC 9285 section 4.3.
+	if segment := q.DataList[0]; segment.GetMode() != utils.ModeAlphanumeric || segment.String() != "%69 VD92EX0" {
+		t.Errorf("got mode %d %q, want an alphanumeric %q", segment.GetMode(), segment.String(), "%69 VD92EX0")
+	}
+	decoded, err := utils.Base45Decode(q.DataList[0].String())
+	if err != nil || string(decoded) != "Hello!!" {
+		t.Errorf("the segment decodes to %q, %v", decoded, err)
+	}
+}
+
+func TestBase45Capacity(t *testing.T) {
+	for _, errorCorrection := range []constants.ErrorCorrectionLevel{constants.ERROR_CORRECT_L, constants.ERROR_CORRECT_H} {
+		for _, version := range []int{1, 2, 10, 40} {
+			base45, byteMode, err := Base45Capacity(version, errorCorrection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if base45 >= byteMode {
+				t.Errorf("version %d-%s: Base45 holds %d bytes, a byte segment %d", version, errorCorrection, base45, byteMode)
+			}
+			// The capacity is exact: one more byte needs a larger version.
+			for n, want := range map[int]bool{base45: true, base45 + 1: false} {
+				comparison, err := CompareBase45(bytes.Repeat([]byte{0xA5}, n), errorCorrection)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fits := comparison.Base45Version != 0 && comparison.Base45Version <= version; fits != want {
+					t.Errorf("version %d-%s: %d bytes fit version %d, want fits %v", version, errorCorrection, n, comparison.Base45Version, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package qr
+
+import (
+	"fmt"
+	"qrcode/constants"
+	"qrcode/image"
+	"qrcode/utils"
+)
+
+// Capacity returns the maximum number of characters of mode that fit a
+// single segment in the version at the error correction level.
+func Capacity(mode, version int, errorCorrection constants.ErrorCorrectionLevel) (int, error) {
+	if !utils.CheckVersion(version) {
+		return 0, &utils.InvalidVersionError{Version: version}
+	}
+	if err := CheckErrorCorrection(errorCorrection); err != nil {
+		return 0, err
+	}
+
+	var countBits int
+	switch mode {
+	case utils.ModeNumeric, utils.ModeAlphanumeric, utils.ModeByte, utils.ModeKanji:
+		var err error
+		if countBits, err = utils.LengthInBits(mode, version); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("Invalid mode: %d", mode)
+	}
+
+	bits := BIT_LIMIT_TABLE[errorCorrection][version] - 4 - countBits
+	var characters int
+	switch mode {
+	case utils.ModeNumeric:
+		// 10 bits per 3 digits, 7 bits for 2 and 4 bits for 1 remaining digit.
+		characters = bits / 10 * 3
+		switch rest := bits % 10; {
+		case rest >= 7:
+			characters += 2
+		case rest >= 4:
+			characters++
+		}
+	case utils.ModeAlphanumeric:
+		// 11 bits per 2 characters and 6 bits for a remaining one.
+		characters = bits / 11 * 2
+		if bits%11 >= 6 {
+			characters++
+		}
+	case utils.ModeByte:
+		characters = bits / 8
+	case utils.ModeKanji:
+		characters = bits / 13
+	}
+	return min(characters, 1<<countBits-1), nil
+}
+
+// SmallestVersion returns the smallest version that holds data at the error
+// correction level, segmenting it as AddData does, without building the
+// symbol. It returns a *utils.DataOverflowError if no version is large enough.
+func SmallestVersion(data string, errorCorrection constants.ErrorCorrectionLevel, optimize int) (int, error) {
+	q, err := NewQRCode(0, errorCorrection, 1, 0, image.PilImage{}, MaskAuto)
+	if err != nil {
+		return 0, err
+	}
+	if err := q.AddData(data, optimize); err != nil {
+		return 0, err
+	}
+	return q.BestFit(0)
+}
+
+// RemainingBits returns the number of data bits still free. For a symbol
+// with automatic versioning it counts against the version BestFit would
+// select now, without selecting it. It returns a *utils.DataOverflowError if
+// the data already overflows.
+func (q *QRCode) RemainingBits() (int, error) {
+	version := q.version
+	if version == 0 {
+		end := 40
+		if q.maxVersion != 0 {
+			end = q.maxVersion
+		}
+		fit, err := fitVersion(q.DataList, q.errorCorrection, max(q.minVersion, 1))
+		if err != nil {
+			return 0, err
+		}
+		if fit == 0 || fit > end {
+			return 0, overflowError(q.DataList, q.errorCorrection, end)
+		}
+		version = fit
+	}
+
+	length, err := bitLength(q.DataList, version)
+	if err != nil {
+		return 0, err
+	}
+	available := BIT_LIMIT_TABLE[q.errorCorrection][version]
+	if length > available {
+		return 0, utils.NewDataOverflowError(length, available)
+	}
+	return available - length, nil
+}
@@ -0,0 +1,115 @@
+package qr
+
+import (
+	"fmt"
+	"qrcode/utils"
+	"strings"
+)
+
+// MaxDecompressedSize limits the payload DecodeCompressed inflates, so a
+// crafted symbol cannot expand into an arbitrarily large buffer.
+const MaxDecompressedSize = 1 << 20
+
+// CompressionReport describes a payload stored by AddCompressed. The versions
+// are the smallest that hold all the data of the symbol, with the payload
+// compressed and with it stored as a plain byte segment; 0 means no version
+// is large enough.
+type CompressionReport struct {
+	OriginalBytes   int
+	CompressedBytes int
+	// Characters counts the alphanumeric characters, prefix included.
+	Characters int
+	// Bits and UncompressedBits are the segment lengths in bits.
+	Bits                int
+	UncompressedBits    int
+	Version             int
+	UncompressedVersion int
+}
+
+// SavedBits returns how many bits compression saved. Short payloads do not
+// compress well enough to make up for Base45, so it may be negative.
+func (r *CompressionReport) SavedBits() int {
+	return r.UncompressedBits - r.Bits
+}
+
+// AvoidedVersion reports whether compression lets the symbol use a smaller
+// version than storing the payload as bytes would.
+func (r *CompressionReport) AvoidedVersion() bool {
+	return r.Version != 0 && (r.UncompressedVersion == 0 || r.Version < r.UncompressedVersion)
+}
+
+// AddCompressed compresses data with zlib, encodes it as Base45 after prefix
+// and appends the result as one alphanumeric segment, as done for payloads
+// such as "HC1:" health certificates. prefix must use the alphanumeric
+// character set. DecodeCompressed reverses the steps.
+func (q *QRCode) AddCompressed(data []byte, prefix string) (*CompressionReport, error) {
+	if !utils.ReAlphaNumeric.MatchString(prefix) {
+		return nil, fmt.Errorf("Invalid prefix: %q is not alphanumeric", prefix)
+	}
+
+	compressed, err := utils.Deflate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	text := prefix + utils.Base45Encode(compressed)
+	segment, err := utils.NewSegment([]byte(text), utils.ModeAlphanumeric)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := utils.NewSegment(data, utils.ModeByte)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CompressionReport{
+		OriginalBytes:   len(data),
+		CompressedBytes: len(compressed),
+		Characters:      len(text),
+	}
+	if report.Version, report.Bits, err = q.fitWith(*segment); err != nil {
+		return nil, err
+	}
+	if report.UncompressedVersion, report.UncompressedBits, err = q.fitWith(*plain); err != nil {
+		return nil, err
+	}
+
+	q.DataList = append(q.DataList, *segment)
+	q.dataCache = nil
+	return report, nil
+}
+
+// fitWith returns the smallest version within the version range that holds
+// the data of the symbol followed by segment, and the length of segment in
+// bits in that version, or in the largest allowed version if none fits.
+func (q *QRCode) fitWith(segment utils.QRData) (int, int, error) {
+	end := 40
+	if q.maxVersion != 0 {
+		end = q.maxVersion
+	}
+	dataList := append(append([]utils.QRData(nil), q.DataList...), segment)
+	version, err := fitVersion(dataList, q.errorCorrection, max(q.minVersion, 1))
+	if err != nil {
+		return 0, 0, err
+	}
+	if version == 0 || version > end {
+		length, err := bitLength(dataList[len(dataList)-1:], end)
+		return 0, length, err
+	}
+	length, err := bitLength(dataList[len(dataList)-1:], version)
+	return version, length, err
+}
+
+// DecodeCompressed reverses AddCompressed: it strips prefix, decodes the
+// Base45 text and inflates the result.
+func DecodeCompressed(text string, prefix string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(text, prefix)
+	if !ok {
+		return nil, fmt.Errorf("Missing prefix: %q", prefix)
+	}
+	compressed, err := utils.Base45Decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return utils.Inflate(compressed, MaxDecompressedSize)
+}
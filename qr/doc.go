@@ -0,0 +1,13 @@
+// Package qr builds QR, Micro QR and rMQR symbols.
+//
+// The package is safe for concurrent use: separate QRCode, MicroQRCode and
+// RMQRCode values may be built from any number of goroutines at once. A
+// single value is not safe for concurrent use and must not be shared
+// between goroutines without synchronization.
+//
+// Module drawers are the exception. Every image initializes its drawers with
+// itself, so a drawer passed to WithModuleDrawer or WithEyeDrawer, or held by
+// an image factory, must not be used by two images that are drawn at the
+// same time. Create a drawer for every Encode or MakeImage call that may run
+// concurrently with another.
+package qr
@@ -0,0 +1,23 @@
+package qr
+
+import (
+	"qrcode/encryption"
+	"qrcode/utils"
+)
+
+// AddEncrypted seals data with encryption.Seal and appends the envelope as
+// Base45 text in one alphanumeric segment. With compress, data is deflated
+// before it is encrypted. encryption.OpenText decrypts the segment text.
+func (q *QRCode) AddEncrypted(data []byte, secret encryption.Secret, compress bool) error {
+	envelope, err := encryption.Seal(data, secret, compress)
+	if err != nil {
+		return err
+	}
+	segment, err := utils.NewBase45Data(envelope)
+	if err != nil {
+		return err
+	}
+	q.DataList = append(q.DataList, *segment)
+	q.dataCache = nil
+	return nil
+}
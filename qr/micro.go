@@ -0,0 +1,403 @@
+package qr
+
+import (
+	"fmt"
+	"os"
+	"qrcode/base"
+	"qrcode/constants"
+	"qrcode/image"
+	"qrcode/utils"
+)
+
+// MICRO_QUIET_ZONE is the quiet zone Micro QR symbols need, half that of QR symbols.
+const MICRO_QUIET_ZONE = 2
+
+type microSymbol struct {
+	version         int
+	errorCorrection constants.ErrorCorrectionLevel
+}
+
+// microSymbolNumbers maps a Micro QR version and error correction level to
+// the symbol number stored in the format information.
+var microSymbolNumbers = map[microSymbol]int{
+	{1, constants.ERROR_CORRECT_L}: 0,
+	{2, constants.ERROR_CORRECT_L}: 1,
+	{2, constants.ERROR_CORRECT_M}: 2,
+	{3, constants.ERROR_CORRECT_L}: 3,
+	{3, constants.ERROR_CORRECT_M}: 4,
+	{4, constants.ERROR_CORRECT_L}: 5,
+	{4, constants.ERROR_CORRECT_M}: 6,
+	{4, constants.ERROR_CORRECT_Q}: 7,
+}
+
+// MicroQRCode builds Micro QR symbols M1-M4. Versions are numbered 1-4 and
+// 0 selects the smallest version that holds the data. M1 only offers error
+// detection and is used with ERROR_CORRECT_L.
+type MicroQRCode struct {
+	modules         *utils.BitMatrix
+	modulesCount    int
+	version         int
+	errorCorrection constants.ErrorCorrectionLevel
+	BoxSize         int
+	border          int
+	maskPattern     int
+	imageFactory    image.PilImage
+	DataList        []utils.QRData
+	dataCache       []byte
+	roles           *utils.RoleMap
+}
+
+func CheckMicroMaskPattern(pattern int) error {
+	if pattern < 0 || pattern > 3 {
+		return &utils.InvalidMaskPatternError{MaskPattern: pattern}
+	}
+	return nil
+}
+
+func NewMicroQRCode(version int, errorCorrection constants.ErrorCorrectionLevel, boxSize, border int, imageFactory image.PilImage, maskPattern int) (*MicroQRCode, error) {
+	if err := CheckBoxSize(boxSize); err != nil {
+		return nil, err
+	}
+	if err := CheckBorder(border); err != nil {
+		return nil, err
+	}
+	if maskPattern != MaskAuto {
+		if err := CheckMicroMaskPattern(maskPattern); err != nil {
+			return nil, err
+		}
+	}
+	if version != 0 && !utils.CheckMicroVersion(version) {
+		return nil, &utils.InvalidVersionError{Version: version}
+	}
+	if errorCorrection == constants.ERROR_CORRECT_H {
+		return nil, fmt.Errorf("Micro QR does not support error correction level H: %w", &utils.InvalidErrorCorrectionError{Level: errorCorrection})
+	}
+	if err := CheckErrorCorrection(errorCorrection); err != nil {
+		return nil, err
+	}
+
+	q := &MicroQRCode{
+		version:         version,
+		errorCorrection: errorCorrection,
+		BoxSize:         boxSize,
+		border:          border,
+		maskPattern:     maskPattern,
+		imageFactory:    imageFactory,
+	}
+	q.Clear()
+	return q, nil
+}
+
+func (q *MicroQRCode) Clear() {
+	// Reset the internal data
+	q.modules = utils.NewBitMatrix(0, 0)
+	q.modulesCount = 0
+	q.dataCache = nil
+	q.DataList = make([]utils.QRData, 0)
+}
+
+func (q *MicroQRCode) Version() int {
+	return q.version
+}
+
+func (q *MicroQRCode) MaskPattern() int {
+	return q.maskPattern
+}
+
+func (q *MicroQRCode) AddData(data any, optimize int) error {
+	if optimize < 0 {
+		return fmt.Errorf("Invalid optimize value: %d", optimize)
+	}
+
+	switch v := data.(type) {
+	case utils.QRData:
+		q.DataList = append(q.DataList, v)
+	case string:
+		qrData, err := utils.NewQRData([]byte(v), 0, true)
+		if err != nil {
+			return err
+		}
+		q.DataList = append(q.DataList, *qrData)
+	default:
+		return fmt.Errorf("Unsupported data type: %T", v)
+	}
+
+	q.dataCache = nil
+	return nil
+}
+
+// BestFit selects the smallest Micro QR version, not below the current one,
+// that holds the data at the error correction level.
+func (q *MicroQRCode) BestFit() (int, error) {
+	for version := max(q.version, 1); version <= 4; version++ {
+		if _, ok := microSymbolNumbers[microSymbol{version, q.errorCorrection}]; !ok {
+			continue
+		}
+		bitLimit, err := utils.MicroDataBits(version, q.errorCorrection)
+		if err != nil {
+			return 0, err
+		}
+
+		buffer := utils.NewBitBuffer()
+		fits := true
+		for i := range q.DataList {
+			if err := q.DataList[i].WriteMicroSegment(buffer, version); err != nil {
+				fits = false
+				break
+			}
+		}
+		if fits && buffer.Len() <= bitLimit {
+			q.version = version
+			q.dataCache = nil
+			return version, nil
+		}
+	}
+	bitLimit, err := utils.MicroDataBits(4, q.errorCorrection)
+	if err != nil {
+		return 0, err
+	}
+	buffer := utils.NewBitBuffer()
+	for i := range q.DataList {
+		if err := q.DataList[i].WriteMicroSegment(buffer, 4); err != nil {
+			return 0, err
+		}
+	}
+	return 0, utils.NewDataOverflowError(buffer.Len(), bitLimit)
+}
+
+func (q *MicroQRCode) Make(fit bool) error {
+	if fit || q.version == 0 {
+		if _, err := q.BestFit(); err != nil {
+			return err
+		}
+	}
+	maskPattern := q.maskPattern
+	if maskPattern == MaskAuto {
+		var err error
+		if maskPattern, err = q.BestMaskPattern(); err != nil {
+			return err
+		}
+	}
+	return q.MakeImpl(false, maskPattern)
+}
+
+func (q *MicroQRCode) MakeImpl(test bool, maskPattern int) error {
+	if err := CheckMicroMaskPattern(maskPattern); err != nil {
+		return err
+	}
+	symbolNumber, ok := microSymbolNumbers[microSymbol{q.version, q.errorCorrection}]
+	if !ok {
+		return fmt.Errorf("Micro QR version M%d does not support this level: %w", q.version, &utils.InvalidErrorCorrectionError{Level: q.errorCorrection})
+	}
+	q.modulesCount = q.version*2 + 9
+
+	q.modules = utils.NewBitMatrix(q.modulesCount, q.modulesCount)
+	q.SetupPositionProbePattern()
+	q.SetupTimingPattern()
+	q.SetupTypeInfo(test, symbolNumber, maskPattern)
+
+	if q.dataCache == nil {
+		qrDataList := make([]*utils.QRData, len(q.DataList))
+		for i := range q.DataList {
+			qrDataList[i] = &q.DataList[i]
+		}
+		dataCache, err := utils.CreateMicroData(q.version, q.errorCorrection, qrDataList)
+		if err != nil {
+			return err
+		}
+		q.dataCache = dataCache
+	}
+	return q.MapData(q.dataCache, maskPattern)
+}
+
+func (q *MicroQRCode) setFunctionModule(row, col int, dark bool, role utils.ModuleRole) {
+	q.modules.SetFunction(row, col, dark)
+	if q.roles != nil {
+		q.roles.Set(row, col, role)
+	}
+}
+
+func (q *MicroQRCode) SetupPositionProbePattern() {
+	for r := 0; r <= 7; r++ {
+		for c := 0; c <= 7; c++ {
+			dark := (r <= 6 && c <= 6) &&
+				(r == 0 || r == 6 || c == 0 || c == 6 || (2 <= r && r <= 4 && 2 <= c && c <= 4))
+			role := utils.RoleFinder
+			if r == 7 || c == 7 {
+				role = utils.RoleSeparator
+			}
+			q.setFunctionModule(r, c, dark, role)
+		}
+	}
+}
+
+func (q *MicroQRCode) SetupTimingPattern() {
+	for i := 8; i < q.modulesCount; i++ {
+		q.setFunctionModule(0, i, i%2 == 0, utils.RoleTiming)
+		q.setFunctionModule(i, 0, i%2 == 0, utils.RoleTiming)
+	}
+}
+
+func (q *MicroQRCode) SetupTypeInfo(test bool, symbolNumber, maskPattern int) {
+	bits := utils.BCHMicroTypeInfo((symbolNumber << 2) | maskPattern)
+
+	// vertical, bits 0-7
+	for i := 0; i < 8; i++ {
+		mod := !test && ((bits>>i)&1) == 1
+		q.setFunctionModule(i+1, 8, mod, utils.RoleFormatInfo)
+	}
+
+	// horizontal, bits 14-8
+	for i := 0; i < 7; i++ {
+		mod := !test && ((bits>>(14-i))&1) == 1
+		q.setFunctionModule(8, i+1, mod, utils.RoleFormatInfo)
+	}
+}
+
+// MapData places the codewords in two module wide columns from the bottom
+// right corner. The last data codeword of M1 and M3 holds only 4 bits.
+func (q *MicroQRCode) MapData(data []byte, maskPattern int) error {
+	rsBlocks, err := base.MicroRSBlocks(q.version, q.errorCorrection)
+	if err != nil {
+		return err
+	}
+	halfCodeword := -1
+	if q.version == 1 || q.version == 3 {
+		halfCodeword = rsBlocks[0].DataCount - 1
+	}
+
+	// codewords holds the codeword index of every bit for the role map.
+	bits := make([]bool, 0, len(data)*8)
+	codewords := make([]int, 0, len(data)*8)
+	for i, b := range data {
+		length := 8
+		if i == halfCodeword {
+			length = 4
+		}
+		for j := 0; j < length; j++ {
+			bits = append(bits, (b>>(7-j))&1 == 1)
+			codewords = append(codewords, i)
+		}
+	}
+
+	maskFunc, err := utils.MaskFunc(utils.MicroMaskPatterns[maskPattern])
+	if err != nil {
+		return err
+	}
+	inc := -1
+	row := q.modulesCount - 1
+	bitIndex := 0
+
+	for col := q.modulesCount - 1; col > 0; col -= 2 {
+		for {
+			for _, c := range []int{col, col - 1} {
+				if !q.modules.IsFunction(row, c) {
+					dark := bitIndex < len(bits) && bits[bitIndex]
+					if maskFunc(row, c) {
+						dark = !dark
+					}
+					q.modules.Set(row, c, dark)
+					if q.roles != nil {
+						codeword := len(data)
+						if bitIndex < len(codewords) {
+							codeword = codewords[bitIndex]
+						}
+						q.roles.Set(row, c, codewordRole(codeword, rsBlocks[0].DataCount, len(data)))
+					}
+					bitIndex++
+				}
+			}
+
+			row += inc
+
+			if row < 0 || row >= q.modulesCount {
+				row -= inc
+				inc = -inc
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// BestMaskPattern returns the mask with the most dark modules along the
+// right and bottom edges, weighting the lighter edge.
+func (q *MicroQRCode) BestMaskPattern() (int, error) {
+	bestScore := -1
+	bestPattern := 0
+
+	for pattern := 0; pattern < 4; pattern++ {
+		if err := q.MakeImpl(true, pattern); err != nil {
+			return 0, err
+		}
+		sumRight, sumBottom := 0, 0
+		for i := 1; i < q.modulesCount; i++ {
+			if q.modules.Get(i, q.modulesCount-1) {
+				sumRight++
+			}
+			if q.modules.Get(q.modulesCount-1, i) {
+				sumBottom++
+			}
+		}
+
+		score := sumRight*16 + sumBottom
+		if sumRight > sumBottom {
+			score = sumBottom*16 + sumRight
+		}
+		if score > bestScore {
+			bestScore = score
+			bestPattern = pattern
+		}
+	}
+	return bestPattern, nil
+}
+
+func (q *MicroQRCode) PrintASCII(out *os.File, tty bool, invert bool) error {
+	if q.dataCache == nil {
+		if err := q.Make(true); err != nil {
+			return err
+		}
+	}
+	return printASCII(out, q.modules, q.border, tty, invert)
+}
+
+// MakeImage builds the symbol if needed and draws it with the colors and
+// drawers of imageFactory, or of the factory given to NewMicroQRCode if
+// imageFactory is the zero value. The "fill_color" and "back_color" kwargs
+// override the factory colors.
+func (q *MicroQRCode) MakeImage(imageFactory image.PilImage, kwargs map[string]interface{}) (image.PilImage, error) {
+	if err := CheckBoxSize(q.BoxSize); err != nil {
+		return image.PilImage{}, err
+	}
+
+	if q.dataCache == nil {
+		if err := q.Make(true); err != nil {
+			return image.PilImage{}, err
+		}
+	}
+
+	return makeImage(q.modules, q.RoleMap(), q.border, q.BoxSize, q, factoryStyle(imageFactory, q.imageFactory), kwargs), nil
+}
+
+// RoleMap classifies every module of the symbol built by Make, using the same
+// placement as the build itself. It returns nil before the symbol is built.
+func (q *MicroQRCode) RoleMap() *utils.RoleMap {
+	if q.dataCache == nil || q.modulesCount == 0 {
+		return nil
+	}
+	candidate := *q
+	candidate.roles = utils.NewRoleMap(q.modulesCount, q.modulesCount)
+	if err := candidate.MakeImpl(true, 0); err != nil {
+		return nil
+	}
+	return candidate.roles
+}
+
+func (q *MicroQRCode) GetMatrix() ([][]bool, error) {
+	if q.dataCache == nil {
+		if err := q.Make(true); err != nil {
+			return nil, err
+		}
+	}
+	return matrixWithBorder(q.modules, q.border), nil
+}
@@ -0,0 +1,283 @@
+package qr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"qrcode/constants"
+	"qrcode/image"
+	"qrcode/utils"
+)
+
+// countRoles counts the modules of each role in the map.
+func countRoles(roles *utils.RoleMap) map[utils.ModuleRole]int {
+	counts := make(map[utils.ModuleRole]int)
+	for r := 0; r < roles.Height(); r++ {
+		for c := 0; c < roles.Width(); c++ {
+			counts[roles.Role(r, c)]++
+		}
+	}
+	return counts
+}
+
+func TestMicroRoleMap(t *testing.T) {
+	tests := []struct {
+		version         int
+		errorCorrection constants.ErrorCorrectionLevel
+		data            string
+		want            map[utils.ModuleRole]int
+	}{
+		// M1 ends its data with a 4-bit codeword.
+		{1, constants.ERROR_CORRECT_L, "12345", map[utils.ModuleRole]int{
+			utils.RoleFinder: 49, utils.RoleSeparator: 15, utils.RoleTiming: 6, utils.RoleFormatInfo: 15,
+			utils.RoleData: 20, utils.RoleErrorCorrection: 16,
+		}},
+		{2, constants.ERROR_CORRECT_L, "01234567", map[utils.ModuleRole]int{
+			utils.RoleFinder: 49, utils.RoleSeparator: 15, utils.RoleTiming: 10, utils.RoleFormatInfo: 15,
+			utils.RoleData: 40, utils.RoleErrorCorrection: 40,
+		}},
+		{3, constants.ERROR_CORRECT_M, "MICRO QR", map[utils.ModuleRole]int{
+			utils.RoleFinder: 49, utils.RoleSeparator: 15, utils.RoleTiming: 14, utils.RoleFormatInfo: 15,
+			utils.RoleData: 68, utils.RoleErrorCorrection: 64,
+		}},
+	}
+	for _, tt := range tests {
+		q, err := NewMicroQRCode(tt.version, tt.errorCorrection, 1, 2, image.PilImage{}, MaskAuto)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.RoleMap() != nil {
+			t.Errorf("M%d: got a role map before the symbol is built", tt.version)
+		}
+		if err := q.AddData(tt.data, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.Make(false); err != nil {
+			t.Fatal(err)
+		}
+		roles := q.RoleMap()
+		if got := countRoles(roles); len(got) != len(tt.want) {
+			t.Errorf("M%d: got roles %v, want %v", tt.version, got, tt.want)
+		} else {
+			for role, n := range tt.want {
+				if got[role] != n {
+					t.Errorf("M%d: got %d %s modules, want %d", tt.version, got[role], role, n)
+				}
+			}
+		}
+
+		// A Micro QR symbol has a single finder pattern.
+		im, err := q.MakeImage(image.PilImage{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := q.modulesCount
+		if !im.IsEye(0, 0) || !im.IsEye(6, 6) || im.IsEye(7, 7) {
+			t.Errorf("M%d: the finder pattern is not drawn as an eye", tt.version)
+		}
+		if im.IsEye(0, n-1) || im.IsEye(n-1, 0) || im.IsEye(n-1, n-1) {
+			t.Errorf("M%d: a corner without a finder pattern is drawn as an eye", tt.version)
+		}
+	}
+}
+
+// matrixRows draws a matrix as strings, "#" for dark and "." for light modules.
+func matrixRows(m [][]bool) []string {
+	rows := make([]string, len(m))
+	for i, row := range m {
+		var s strings.Builder
+		for _, dark := range row {
+			if dark {
+				s.WriteByte('#')
+			} else {
+				s.WriteByte('.')
+			}
+		}
+		rows[i] = s.String()
+	}
+	return rows
+}
+
+// TestMicroKnownAnswers checks complete symbols. The M2 symbol is the
+// "01234567" example of ISO/IEC 18004 Annex I, the others come from an
+// independent encoder. M1 and M3 end their data with a 4-bit codeword.
+func TestMicroKnownAnswers(t *testing.T) {
+	tests := []struct {
+		version         int
+		errorCorrection constants.ErrorCorrectionLevel
+		data            string
+		mask            int
+		codewords       string
+		matrix          []string
+	}{
+		{
+			version: 1, errorCorrection: constants.ERROR_CORRECT_L, data: "12345", mask: 2,
+			codewords: "A3 DA D0 6E C7",
+			matrix: []string{
+				"#######.#.#",
+				"#.....#.##.",
+				"#.###.#.#..",
+				"#.###.#....",
+				"#.###.#.###",
+				"#.....#..##",
+				"#######.#..",
+				".........##",
+				"##..###..##",
+				".#.#...##..",
+				"####.....##",
+			},
+		},
+		{
+			version: 2, errorCorrection: constants.ERROR_CORRECT_L, data: "01234567", mask: 1,
+			codewords: "40 18 AC C3 00 86 0D 22 AE 30",
+			matrix: []string{
+				"#######.#.#.#",
+				"#.....#.###.#",
+				"#.###.#..##.#",
+				"#.###.#..####",
+				"#.###.#.###..",
+				"#.....#.#...#",
+				"#######..####",
+				".........##..",
+				"##.#....#...#",
+				".##.#.#.#.#.#",
+				"###..#######.",
+				"...#.#....##.",
+				"###.#..##.###",
+			},
+		},
+		{
+			version: 3, errorCorrection: constants.ERROR_CORRECT_M, data: "MICRO QR", mask: 0,
+			codewords: "61 F8 23 78 B9 2B 40 00 00 D8 8F 0C 72 6E AA 91 6C",
+			matrix: []string{
+				"#######.#.#.#.#",
+				"#.....#..##.###",
+				"#.###.#.#..##.#",
+				"#.###.#.#...###",
+				"#.###.#.##...##",
+				"#.....#.#...#.#",
+				"#######..#..###",
+				"........##.....",
+				"#....##.#..#.#.",
+				"....#.#.....###",
+				"#..#...####....",
+				"..#.#.###..#.#.",
+				"#.##..#########",
+				".#..#.##......#",
+				"###.###..####.#",
+			},
+		},
+		{
+			version: 3, errorCorrection: constants.ERROR_CORRECT_L, data: "1", mask: 2,
+			codewords: "02 20 00 EC 11 EC 11 EC 11 EC 00 0B 24 90 56 57 8D",
+			matrix: []string{
+				"#######.#.#.#.#",
+				"#.....#....#.#.",
+				"#.###.#.###.#.#",
+				"#.###.#.#.#.#.#",
+				"#.###.#...#.#.#",
+				"#.....#.#..##..",
+				"#######.....###",
+				".........#.#.##",
+				"######...##..#.",
+				".####.#.####...",
+				"##...##.##.##.#",
+				"...##.#.#.###.#",
+				"##.#.#......###",
+				"...#..###.#.###",
+				"#...#####..###.",
+			},
+		},
+		{
+			version: 4, errorCorrection: constants.ERROR_CORRECT_Q, data: "HELLO", mask: 0,
+			codewords: "25 61 6F 19 80 00 EC 11 EC 11 C8 96 B5 F2 BC 48 B2 EF AF 14 69 B0 87 E7",
+			matrix: []string{
+				"#######.#.#.#.#.#",
+				"#.....#.#.#.#.##.",
+				"#.###.#.#...####.",
+				"#.###.#..#.#...#.",
+				"#.###.#...##.####",
+				"#.....#..##....##",
+				"#######.#..#.##..",
+				"........#.......#",
+				"#.##.#..##...##.#",
+				"..#...###.##.###.",
+				"######.....###.##",
+				".#.####.####.##.#",
+				"#..#.....######.#",
+				".###....##.....#.",
+				"##.#..#####...#.#",
+				".#..##.##.#.#...#",
+				"#...####.##...###",
+			},
+		},
+	}
+	for _, tt := range tests {
+		name := fmt.Sprintf("M%d-%s %q", tt.version, tt.errorCorrection, tt.data)
+		for _, maskPattern := range []int{MaskAuto, tt.mask} {
+			q, err := NewMicroQRCode(tt.version, tt.errorCorrection, 1, 0, image.PilImage{}, maskPattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := q.AddData(tt.data, 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := q.Make(false); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if got := fmt.Sprintf("% X", q.dataCache); got != tt.codewords {
+				t.Errorf("%s: got codewords %s, want %s", name, got, tt.codewords)
+			}
+			if got := matrixRows(matrixWithBorder(q.modules, 0)); !reflect.DeepEqual(got, tt.matrix) {
+				t.Errorf("%s, mask %d: got matrix\n%s\nwant\n%s", name, maskPattern, strings.Join(got, "\n"), strings.Join(tt.matrix, "\n"))
+			}
+		}
+	}
+}
+
+// TestMicroFormatInfo checks the format information of ISO/IEC 18004 Table
+// C.1 for every symbol number and mask, and where MakeImpl places its bits.
+func TestMicroFormatInfo(t *testing.T) {
+	want := []int{
+		0x4445, 0x4172, 0x4E2B, 0x4B1C, 0x55AE, 0x5099, 0x5FC0, 0x5AF7,
+		0x6793, 0x62A4, 0x6DFD, 0x68CA, 0x7678, 0x734F, 0x7C16, 0x7921,
+		0x06DE, 0x03E9, 0x0CB0, 0x0987, 0x1735, 0x1202, 0x1D5B, 0x186C,
+		0x2508, 0x203F, 0x2F66, 0x2A51, 0x34E3, 0x31D4, 0x3E8D, 0x3BBA,
+	}
+	for data, bits := range want {
+		if got := utils.BCHMicroTypeInfo(data); got != bits {
+			t.Errorf("BCHMicroTypeInfo(%05b) = %015b, want %015b", data, got, bits)
+		}
+	}
+
+	for symbol, symbolNumber := range microSymbolNumbers {
+		for maskPattern := 0; maskPattern < 4; maskPattern++ {
+			q, err := NewMicroQRCode(symbol.version, symbol.errorCorrection, 1, 0, image.PilImage{}, maskPattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := q.AddData("1", 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := q.Make(false); err != nil {
+				t.Fatal(err)
+			}
+			// Bits 0-7 run down column 8 from row 1 and bits 14-7 along
+			// row 8 from column 1, sharing the module at 8, 8.
+			got := 0
+			for i := 0; i < 8; i++ {
+				if q.modules.Get(i+1, 8) {
+					got |= 1 << i
+				}
+				if q.modules.Get(8, i+1) {
+					got |= 1 << (14 - i)
+				}
+			}
+			if bits := want[symbolNumber<<2|maskPattern]; got != bits {
+				t.Errorf("M%d-%s, mask %d: got format information %015b, want %015b", symbol.version, symbol.errorCorrection, maskPattern, got, bits)
+			}
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"qrcode/constants"
+	"qrcode/image"
+	"qrcode/image/styles/moduledrawers"
+	"qrcode/utils"
+)
+
+// Format selects what Encode renders.
+type Format string
+
+const (
+	// FormatPNG renders a PNG image.
+	FormatPNG Format = "png"
+	// FormatASCII renders the symbol as text, two rows of modules per line.
+	FormatASCII Format = "ascii"
+)
+
+// Option configures a symbol built by New or Encode. Options validate their
+// arguments and report invalid values as errors from New or Encode.
+type Option func(*options) error
+
+type options struct {
+	version         int
+	errorCorrection constants.ErrorCorrectionLevel
+	boxSize         int
+	border          int
+	maskPattern     int
+	format          Format
+	style           imageStyle
+}
+
+// defaultOptions selects the version automatically, uses ERROR_CORRECT_M, a
+// box size of 10 pixels, a border of 4 modules, the mask pattern with the
+// lowest penalty score and black square modules on white, rendered as PNG.
+func defaultOptions() options {
+	return options{
+		version:         0,
+		errorCorrection: constants.ERROR_CORRECT_M,
+		boxSize:         10,
+		border:          4,
+		maskPattern:     MaskAuto,
+		format:          FormatPNG,
+	}
+}
+
+// WithVersion fixes the version between 1 and 40. Version 0 selects the
+// smallest version that holds the data.
+func WithVersion(version int) Option {
+	return func(o *options) error {
+		if version != 0 && !utils.CheckVersion(version) {
+			return &utils.InvalidVersionError{Version: version}
+		}
+		o.version = version
+		return nil
+	}
+}
+
+// WithErrorCorrection sets the error correction level to one of the
+// constants.ERROR_CORRECT_* values.
+func WithErrorCorrection(level constants.ErrorCorrectionLevel) Option {
+	return func(o *options) error {
+		if err := CheckErrorCorrection(level); err != nil {
+			return err
+		}
+		o.errorCorrection = level
+		return nil
+	}
+}
+
+// WithBoxSize sets the size of a module in pixels.
+func WithBoxSize(size int) Option {
+	return func(o *options) error {
+		if size < 1 {
+			return fmt.Errorf("Invalid box size: %d", size)
+		}
+		o.boxSize = size
+		return nil
+	}
+}
+
+// WithBorder sets the width of the quiet zone in modules. The specification
+// asks for at least 4.
+func WithBorder(border int) Option {
+	return func(o *options) error {
+		if err := CheckBorder(border); err != nil {
+			return err
+		}
+		o.border = border
+		return nil
+	}
+}
+
+// WithMask forces a mask pattern between 0 and 7, or MaskAuto.
+func WithMask(pattern int) Option {
+	return func(o *options) error {
+		if pattern != MaskAuto {
+			if err := CheckMaskPattern(pattern); err != nil {
+				return err
+			}
+		}
+		o.maskPattern = pattern
+		return nil
+	}
+}
+
+// WithColors sets the color of the dark modules and of the background.
+func WithColors(fill, back color.Color) Option {
+	return func(o *options) error {
+		if fill == nil || back == nil {
+			return fmt.Errorf("Invalid colors: %v, %v", fill, back)
+		}
+		o.style.fillColor = fill
+		o.style.backColor = back
+		return nil
+	}
+}
+
+// WithModuleDrawer draws the dark modules with drawer instead of filling
+// their box. It also draws the finder patterns unless WithEyeDrawer is set.
+// The image initializes drawer with itself, so drawer must not be shared
+// with an Encode call that runs at the same time.
+func WithModuleDrawer(drawer moduledrawers.QRModuleDrawer) Option {
+	return func(o *options) error {
+		if drawer == nil {
+			return fmt.Errorf("Invalid module drawer: nil")
+		}
+		o.style.moduleDrawer = drawer
+		return nil
+	}
+}
+
+// WithEyeDrawer draws the dark modules of the finder patterns with drawer.
+// Like the module drawer, it must not be shared between concurrent calls.
+func WithEyeDrawer(drawer moduledrawers.QRModuleDrawer) Option {
+	return func(o *options) error {
+		if drawer == nil {
+			return fmt.Errorf("Invalid eye drawer: nil")
+		}
+		o.style.eyeDrawer = drawer
+		return nil
+	}
+}
+
+// WithEmbeddedImage draws img over the middle of the symbol. It requires
+// ERROR_CORRECT_H.
+func WithEmbeddedImage(img stdimage.Image) Option {
+	return func(o *options) error {
+		if img == nil {
+			return fmt.Errorf("Invalid embedded image: nil")
+		}
+		o.style.embeddedImage = img
+		return nil
+	}
+}
+
+// WithFormat selects what Encode renders.
+func WithFormat(format Format) Option {
+	return func(o *options) error {
+		switch format {
+		case FormatPNG, FormatASCII:
+		default:
+			return fmt.Errorf("Invalid format: %s", format)
+		}
+		o.format = format
+		return nil
+	}
+}
+
+func applyOptions(opts []Option) (options, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return options{}, err
+		}
+	}
+	if o.style.embeddedImage != nil && o.errorCorrection != constants.ERROR_CORRECT_H {
+		return options{}, fmt.Errorf("Error correction level must be ERROR_CORRECT_H if an embedded image is provided")
+	}
+	return o, nil
+}
+
+func newWithOptions(o options) (*QRCode, error) {
+	q, err := NewQRCode(o.version, o.errorCorrection, o.boxSize, o.border, image.PilImage{}, o.maskPattern)
+	if err != nil {
+		return nil, err
+	}
+	q.style = o.style
+	return q, nil
+}
+
+// New creates an empty symbol configured by opts. Options not given keep the
+// defaults described on each option.
+func New(opts ...Option) (*QRCode, error) {
+	o, err := applyOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return newWithOptions(o)
+}
+
+// Encode builds a symbol holding data, which may be anything AddData
+// accepts, and returns it rendered in the format selected by WithFormat.
+func Encode(data any, opts ...Option) ([]byte, error) {
+	o, err := applyOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	q, err := newWithOptions(o)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.AddData(data, 0); err != nil {
+		return nil, err
+	}
+	// Only fit the version when none was given, so WithVersion is honoured.
+	if err := q.Make(false); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch o.format {
+	case FormatASCII:
+		if err := printASCII(&buf, q.modules, q.border, false, false); err != nil {
+			return nil, err
+		}
+	default:
+		im, err := q.MakeImage(image.PilImage{}, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := im.Save(&buf, string(o.format), nil); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -2,27 +2,37 @@ package qr
 
 import (
 	"fmt"
+	"io"
+	"math/big"
 	"os"
 	"qrcode/base"
 	"qrcode/constants"
 	"qrcode/image"
 	"qrcode/utils"
-	"reflect"
+	"strings"
+	"sync"
 )
 
-type ModulesType [][]*bool
-
 type QRCode struct {
-	modules         ModulesType
-	modulesCount    int
-	version         int
-	errorCorrection int
-	BoxSize         int
-	border          int
-	maskPattern     int
-	imageFactory    image.PilImage
-	DataList        []utils.QRData
-	dataCache       []int
+	modules              *utils.BitMatrix
+	modulesCount         int
+	version              int
+	errorCorrection      constants.ErrorCorrectionLevel
+	usedErrorCorrection  constants.ErrorCorrectionLevel
+	boostErrorCorrection bool
+	minVersion           int
+	maxVersion           int
+	BoxSize              int
+	border               int
+	maskPattern          int
+	usedMaskPattern      int
+	imageFactory         image.PilImage
+	DataList             []utils.QRData
+	dataCache            []int
+	maskScores           []utils.PenaltyScore
+	roles                *utils.RoleMap
+	autoECI              bool
+	style                imageStyle
 }
 
 type ActiveWithNeighbors struct {
@@ -37,20 +47,74 @@ type ActiveWithNeighbors struct {
 	SE bool
 }
 
-// Cache modules generated just based on the QR Code version
-var precomputedQRBlanks = make(map[int]ModulesType)
+// Cache modules generated just based on the QR Code version. The cache is
+// shared by all QRCode values, so access goes through precomputedQRBlanksMu.
+var (
+	precomputedQRBlanksMu sync.RWMutex
+	precomputedQRBlanks   = make(map[int]*utils.BitMatrix)
+)
+
+// cachedBlank returns a copy of the cached function patterns of version.
+func cachedBlank(version int) (*utils.BitMatrix, bool) {
+	precomputedQRBlanksMu.RLock()
+	defer precomputedQRBlanksMu.RUnlock()
+	blank, ok := precomputedQRBlanks[version]
+	if !ok {
+		return nil, false
+	}
+	return blank.Clone(), true
+}
+
+// storeBlank caches a copy of the function patterns of version.
+func storeBlank(version int, blank *utils.BitMatrix) {
+	precomputedQRBlanksMu.Lock()
+	defer precomputedQRBlanksMu.Unlock()
+	precomputedQRBlanks[version] = blank.Clone()
+}
 
+// Make builds an image of data. kwargs may set "version", "error_correction",
+// "box_size", "border" and "mask_pattern"; missing values default to
+// automatic versioning, ERROR_CORRECT_M, 10, 4 and MaskAuto. The error
+// correction level may be given as a constants.ErrorCorrectionLevel or a level
+// name such as "H". Plain ints are rejected, since their meaning changed with
+// the numbering of the levels. Encode offers the same with typed options.
 func Make(data interface{}, kwargs map[string]interface{}) (image.PilImage, error) {
-	version := kwargs["version"].(int)
-	errorCorrection := kwargs["error_correction"].(int)
-	boxSize := kwargs["box_size"].(int)
-	border := kwargs["border"].(int)
-	maskPattern := kwargs["mask_pattern"].(int)
-	qr, err := NewQRCode(version, errorCorrection, boxSize, border, image.PilImage{}, maskPattern)
+	errorCorrection := constants.ERROR_CORRECT_M
+	switch arg := kwargs["error_correction"].(type) {
+	case nil:
+	case constants.ErrorCorrectionLevel:
+		errorCorrection = arg
+	case string:
+		level, err := constants.ParseErrorCorrectionLevel(arg)
+		if err != nil {
+			return image.PilImage{}, err
+		}
+		errorCorrection = level
+	default:
+		return image.PilImage{}, fmt.Errorf("Invalid error_correction: %v (%T)", arg, arg)
+	}
+
+	args := make(map[string]int)
+	defaults := map[string]int{
+		"version":      0,
+		"box_size":     10,
+		"border":       4,
+		"mask_pattern": MaskAuto,
+	}
+	for key, value := range defaults {
+		args[key] = value
+		if arg, ok := kwargs[key]; ok {
+			v, ok := arg.(int)
+			if !ok {
+				return image.PilImage{}, fmt.Errorf("Invalid %s: %v", key, arg)
+			}
+			args[key] = v
+		}
+	}
+	qr, err := NewQRCode(args["version"], errorCorrection, args["box_size"], args["border"], image.PilImage{}, args["mask_pattern"])
 	if err != nil {
 		return image.PilImage{}, err
 	}
-	qr.SetVersion(version)
 
 	if err := qr.AddData(data, 0); err != nil {
 		return image.PilImage{}, err
@@ -73,19 +137,21 @@ func CheckBorder(border int) error {
 	return nil
 }
 
+// MaskAuto selects the mask pattern with the lowest penalty score.
+const MaskAuto = -1
+
 func CheckMaskPattern(pattern int) error {
 	if pattern < 0 || pattern > 7 {
-		return fmt.Errorf("Invalid mask pattern: %d", pattern)
+		return &utils.InvalidMaskPatternError{MaskPattern: pattern}
 	}
 	return nil
 }
 
-func Copy2DArray(src ModulesType) ModulesType {
-	dst := make(ModulesType, len(src))
-	for i := range src {
-		dst[i] = append([]*bool(nil), src[i]...)
+func CheckErrorCorrection(level constants.ErrorCorrectionLevel) error {
+	if !level.Valid() {
+		return &utils.InvalidErrorCorrectionError{Level: level}
 	}
-	return dst
+	return nil
 }
 
 // dataCount returns the data count of an RSBLOCK
@@ -93,10 +159,11 @@ func dataCount(block base.RSBlock) int {
 	return block.DataCount
 }
 
-// BIT_LIMIT_TABLE precomputes bit count limits, indexed by error correction level and code size
+// BIT_LIMIT_TABLE precomputes bit count limits, indexed by error correction
+// level and code size. The row of the invalid zero level is nil.
 var BIT_LIMIT_TABLE = func() [][]int {
-	table := make([][]int, 4)
-	for errorCorrection := 0; errorCorrection < 4; errorCorrection++ {
+	table := make([][]int, constants.ERROR_CORRECT_H+1)
+	for _, errorCorrection := range errorCorrectionOrder {
 		table[errorCorrection] = make([]int, 41)
 		for version := 1; version <= 40; version++ {
 			rsBlocks, err := base.RSBlocks(version, errorCorrection)
@@ -113,28 +180,34 @@ var BIT_LIMIT_TABLE = func() [][]int {
 	return table
 }()
 
-func NewQRCode(version int, errorCorrection, boxSize, border int, imageFactory image.PilImage, maskPattern int) (*QRCode, error) {
+func NewQRCode(version int, errorCorrection constants.ErrorCorrectionLevel, boxSize, border int, imageFactory image.PilImage, maskPattern int) (*QRCode, error) {
 	if err := CheckBoxSize(boxSize); err != nil {
 		return nil, err
 	}
 	if err := CheckBorder(border); err != nil {
 		return nil, err
 	}
-	if maskPattern != 0 {
+	if maskPattern != MaskAuto {
 		if err := CheckMaskPattern(maskPattern); err != nil {
 			return nil, err
 		}
 	}
+	if err := CheckErrorCorrection(errorCorrection); err != nil {
+		return nil, err
+	}
 
 	qr := &QRCode{
-		version:         version,
-		errorCorrection: errorCorrection,
-		BoxSize:         boxSize,
-		border:          border,
-		maskPattern:     maskPattern,
-		imageFactory:    imageFactory,
+		version:             version,
+		errorCorrection:     errorCorrection,
+		usedErrorCorrection: errorCorrection,
+		BoxSize:             boxSize,
+		border:              border,
+		maskPattern:         maskPattern,
+		imageFactory:        imageFactory,
+	}
+	if err := qr.SetVersion(version); err != nil {
+		return nil, err
 	}
-	qr.SetVersion(version)
 
 	qr.Clear()
 	return qr, nil
@@ -142,38 +215,111 @@ func NewQRCode(version int, errorCorrection, boxSize, border int, imageFactory i
 
 func (q *QRCode) Clear() {
 	// Reset the internal data
-	q.modules = make(ModulesType, 0)
+	q.modules = utils.NewBitMatrix(0, 0)
 	q.modulesCount = 0
 	q.dataCache = nil
 	q.DataList = make([]utils.QRData, 0)
 }
 
+// Version returns the symbol version, or 0 until it is fixed with
+// SetVersion or selected by BestFit or Make.
 func (q *QRCode) Version() int {
-	if q.version == 0 {
-		q.BestFit(q.version)
-	}
 	return q.version
 }
 
-func (q *QRCode) SetVersion(value int) int {
+// SetVersion fixes the version, or selects it automatically with 0.
+func (q *QRCode) SetVersion(value int) error {
 	if value != 0 && !utils.CheckVersion(value) {
-		panic(fmt.Sprintf("Invalid version: %d", value))
+		return &utils.InvalidVersionError{Version: value}
 	}
 	q.version = value
-	return q.version
+	q.dataCache = nil
+	return nil
+}
+
+// MinVersion returns the smallest version BestFit may select, or 0 if unbounded.
+func (q *QRCode) MinVersion() int {
+	return q.minVersion
+}
+
+// MaxVersion returns the largest version BestFit may select, or 0 if unbounded.
+func (q *QRCode) MaxVersion() int {
+	return q.maxVersion
+}
+
+// SetVersionRange bounds the versions BestFit may select, so symbols keep a
+// consistent size. A bound of 0 leaves that side unbounded.
+func (q *QRCode) SetVersionRange(minVersion, maxVersion int) error {
+	if minVersion != 0 && !utils.CheckVersion(minVersion) {
+		return &utils.InvalidVersionError{Version: minVersion}
+	}
+	if maxVersion != 0 && !utils.CheckVersion(maxVersion) {
+		return &utils.InvalidVersionError{Version: maxVersion}
+	}
+	if minVersion != 0 && maxVersion != 0 && minVersion > maxVersion {
+		return fmt.Errorf("Invalid version range: %d-%d", minVersion, maxVersion)
+	}
+	q.minVersion = minVersion
+	q.maxVersion = maxVersion
+	q.dataCache = nil
+	return nil
+}
+
+// BoostErrorCorrection reports whether Make raises the error correction level
+// as far as the data still fits the selected version.
+func (q *QRCode) BoostErrorCorrection() bool {
+	return q.boostErrorCorrection
+}
+
+// SetBoostErrorCorrection enables or disables raising the error correction level.
+func (q *QRCode) SetBoostErrorCorrection(value bool) {
+	q.boostErrorCorrection = value
+	q.dataCache = nil
+}
+
+// ErrorCorrection returns the error correction level the symbol is built
+// with. It is higher than the requested level if Make boosted it.
+func (q *QRCode) ErrorCorrection() constants.ErrorCorrectionLevel {
+	return q.usedErrorCorrection
 }
 
 func (q *QRCode) MaskPattern() int {
 	return q.maskPattern
 }
 
-func (q *QRCode) SetMaskPattern(value int) {
-	if err := CheckMaskPattern(value); err != nil {
-		panic(err)
+// SetMaskPattern forces a mask pattern 0-7, or selects it automatically with MaskAuto.
+func (q *QRCode) SetMaskPattern(value int) error {
+	if value != MaskAuto {
+		if err := CheckMaskPattern(value); err != nil {
+			return err
+		}
 	}
 	q.maskPattern = value
+	return nil
+}
+
+// MaskScores returns the penalty scores of the mask patterns 0-7 from the
+// last automatic selection, or nil if no selection has been made.
+func (q *QRCode) MaskScores() []utils.PenaltyScore {
+	if q.maskScores == nil {
+		return nil
+	}
+	return append([]utils.PenaltyScore(nil), q.maskScores...)
 }
 
+// MaxReaderSize is the number of bytes AddData reads at most from an
+// io.Reader, the byte mode capacity of version 40 at level L.
+const MaxReaderSize = 2953
+
+// AddData appends data to the symbol:
+//
+//   - a string; with optimize greater than 0 it is split into the mixed-mode
+//     segments that take the fewest bits, otherwise it becomes one segment
+//   - a []byte, kept as binary byte mode data
+//   - a Base45 value, encoded as Base45 text in one alphanumeric segment
+//   - an io.Reader, read up to MaxReaderSize bytes as with AddReader
+//   - an integer type or *big.Int, which must not be negative, in numeric mode
+//   - a utils.QRData or *utils.QRData segment, such as from utils.NewSegment
 func (q *QRCode) AddData(data any, optimize int) error {
 	if optimize < 0 {
 		return fmt.Errorf("Invalid optimize value: %d", optimize)
@@ -182,21 +328,50 @@ func (q *QRCode) AddData(data any, optimize int) error {
 	switch v := data.(type) {
 	case utils.QRData:
 		q.DataList = append(q.DataList, v)
+	case *utils.QRData:
+		if v == nil {
+			return fmt.Errorf("Unsupported data: nil segment")
+		}
+		q.DataList = append(q.DataList, *v)
+	case Base45:
+		segment, err := utils.NewBase45Data(v)
+		if err != nil {
+			return err
+		}
+		q.DataList = append(q.DataList, *segment)
+	case []byte:
+		segment, err := utils.NewSegment(v, utils.ModeByte)
+		if err != nil {
+			return err
+		}
+		q.DataList = append(q.DataList, *segment)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, *big.Int:
+		digits, err := numericDigits(v)
+		if err != nil {
+			return err
+		}
+		segment, err := utils.NewSegment([]byte(digits), utils.ModeNumeric)
+		if err != nil {
+			return err
+		}
+		q.DataList = append(q.DataList, *segment)
+	case io.Reader:
+		return q.AddReader(v, MaxReaderSize)
 	case string:
 		if optimize > 0 {
-			chunks, err := utils.OptimalDataChunks([]byte(v), optimize)
+			chunks, err := q.optimalChunks([]byte(v))
 			if err != nil {
 				return err
 			}
 			for _, chunk := range chunks {
-				q.DataList = append(q.DataList, *chunk)
+				q.appendText(*chunk)
 			}
 		} else {
 			data, err := utils.NewQRData([]byte(v), 0, true)
 			if err != nil {
 				return err
 			}
-			q.DataList = append(q.DataList, *data)
+			q.appendText(*data)
 		}
 	default:
 		return fmt.Errorf("Unsupported data type: %T", v)
@@ -206,35 +381,228 @@ func (q *QRCode) AddData(data any, optimize int) error {
 	return nil
 }
 
+// AddReader reads r to the end and appends its content as binary byte mode
+// data. It fails without adding anything if r holds more than limit bytes.
+func (q *QRCode) AddReader(r io.Reader, limit int64) error {
+	if limit < 0 {
+		return fmt.Errorf("Invalid reader limit: %d", limit)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > limit {
+		return fmt.Errorf("Reader data exceeds %d bytes", limit)
+	}
+	return q.AddData(data, 0)
+}
+
+// numericDigits returns the decimal digits of a non-negative integer.
+func numericDigits(v any) (string, error) {
+	var digits string
+	switch n := v.(type) {
+	case *big.Int:
+		if n == nil {
+			return "", fmt.Errorf("Unsupported data: nil *big.Int")
+		}
+		digits = n.String()
+	default:
+		digits = fmt.Sprint(n)
+	}
+	if strings.HasPrefix(digits, "-") {
+		return "", fmt.Errorf("Negative numbers cannot be encoded in numeric mode: %s", digits)
+	}
+	return digits, nil
+}
+
+// versionClasses are the version ranges sharing character count lengths.
+var versionClasses = [][2]int{{1, 9}, {10, 26}, {27, 40}}
+
+// optimalChunks segments data for the version it will be encoded in. With
+// automatic versioning each version class is tried from the smallest, and the
+// first segmentation that fits a version of its own class is used.
+func (q *QRCode) optimalChunks(data []byte) ([]*utils.QRData, error) {
+	if q.version != 0 {
+		return utils.OptimalDataChunks(data, q.version)
+	}
+
+	var chunks []*utils.QRData
+	for _, class := range versionClasses {
+		var err error
+		chunks, err = utils.OptimalDataChunks(data, class[0])
+		if err != nil {
+			return nil, err
+		}
+		dataList := append([]utils.QRData{}, q.DataList...)
+		for _, chunk := range chunks {
+			dataList = append(dataList, *chunk)
+		}
+		version, err := fitVersion(dataList, q.errorCorrection, class[0])
+		if err != nil {
+			return nil, err
+		}
+		if version != 0 && version <= class[1] {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// AddGS1 adds a GS1 element string and puts the symbol in FNC1 first position mode.
+func (q *QRCode) AddGS1(builder *utils.GS1Builder) error {
+	segments, err := builder.Segments()
+	if err != nil {
+		return err
+	}
+
+	if !q.hasFNC1() {
+		// The FNC1 mode indicator follows any Structured Append or ECI header.
+		pos := 0
+		for pos < len(q.DataList) {
+			mode := q.DataList[pos].GetMode()
+			if mode != utils.ModeStructuredAppend && mode != utils.ModeECI {
+				break
+			}
+			pos++
+		}
+		fnc1 := utils.NewFNC1FirstData()
+		q.DataList = append(q.DataList[:pos], append([]utils.QRData{*fnc1}, q.DataList[pos:]...)...)
+	}
+
+	for _, segment := range segments {
+		q.DataList = append(q.DataList, *segment)
+	}
+	q.dataCache = nil
+	return nil
+}
+
+// hasFNC1 reports whether the data list already declares an FNC1 mode.
+func (q *QRCode) hasFNC1() bool {
+	for _, data := range q.DataList {
+		if data.GetMode() == utils.ModeFNC1First || data.GetMode() == utils.ModeFNC1Second {
+			return true
+		}
+	}
+	return false
+}
+
+// AutoECI reports whether a UTF-8 ECI segment is added in front of non-ASCII text.
+func (q *QRCode) AutoECI() bool {
+	return q.autoECI
+}
+
+// SetAutoECI enables or disables declaring UTF-8 text with an ECI segment.
+func (q *QRCode) SetAutoECI(value bool) {
+	q.autoECI = value
+}
+
+// appendText appends a segment built from a string, declaring it as UTF-8
+// first when auto ECI is enabled and the byte segment is not plain ASCII.
+func (q *QRCode) appendText(data utils.QRData) {
+	if q.autoECI && data.GetMode() == utils.ModeByte && !isASCII(data.String()) && q.activeECI() != utils.ECIUTF8 {
+		eci, err := utils.NewECIData(utils.ECIUTF8)
+		if err == nil {
+			q.DataList = append(q.DataList, *eci)
+		}
+	}
+	q.DataList = append(q.DataList, data)
+}
+
+// activeECI returns the assignment number of the last ECI segment, or -1 if there is none.
+func (q *QRCode) activeECI() int {
+	for i := len(q.DataList) - 1; i >= 0; i-- {
+		if q.DataList[i].GetMode() == utils.ModeECI {
+			return q.DataList[i].ECI()
+		}
+	}
+	return -1
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
 func (q *QRCode) Make(fit bool) error {
-	if fit || q.Version() == 0 {
-		q.BestFit(q.Version())
+	if fit || q.version == 0 {
+		if _, err := q.BestFit(q.version); err != nil {
+			return err
+		}
 	}
-	if q.maskPattern == 0 {
-		q.MakeImpl(false, q.BestMaskPattern())
-	} else {
-		q.MakeImpl(false, q.maskPattern)
+	if err := q.boostLevel(); err != nil {
+		return err
+	}
+
+	maskPattern := q.maskPattern
+	if maskPattern == MaskAuto {
+		var err error
+		if maskPattern, err = q.BestMaskPattern(); err != nil {
+			return err
+		}
+	}
+	q.usedMaskPattern = maskPattern
+	return q.MakeImpl(false, maskPattern)
+}
+
+// errorCorrectionOrder lists the error correction levels from lowest to highest recovery capacity.
+var errorCorrectionOrder = []constants.ErrorCorrectionLevel{
+	constants.ERROR_CORRECT_L,
+	constants.ERROR_CORRECT_M,
+	constants.ERROR_CORRECT_Q,
+	constants.ERROR_CORRECT_H,
+}
+
+// boostLevel selects the error correction level to build with: the requested
+// level or, when boosting is enabled, the highest level at which the data
+// still fits the current version.
+func (q *QRCode) boostLevel() error {
+	level := q.errorCorrection
+	if q.boostErrorCorrection {
+		length, err := bitLength(q.DataList, q.version)
+		if err != nil {
+			return err
+		}
+		boost := false
+		for _, candidate := range errorCorrectionOrder {
+			if candidate == q.errorCorrection {
+				boost = true
+			} else if boost && length <= BIT_LIMIT_TABLE[candidate][q.version] {
+				level = candidate
+			}
+		}
+	}
+	if level != q.usedErrorCorrection {
+		q.usedErrorCorrection = level
+		q.dataCache = nil
 	}
 	return nil
 }
 
-func (q *QRCode) MakeImpl(test bool, maskPattern int) {
+func (q *QRCode) MakeImpl(test bool, maskPattern int) error {
+	if err := CheckMaskPattern(maskPattern); err != nil {
+		return err
+	}
+	if err := q.ensureVersion(); err != nil {
+		return err
+	}
 	q.modulesCount = q.Version()*4 + 17
 
-	if precomputedModules, ok := precomputedQRBlanks[q.Version()]; ok {
-		q.modules = Copy2DArray(precomputedModules)
+	// The cached blank carries no roles, so role maps are built from scratch.
+	if blank, ok := cachedBlank(q.Version()); ok && q.roles == nil {
+		q.modules = blank
 	} else {
-		q.modules = make(ModulesType, q.modulesCount)
-		for i := range q.modules {
-			q.modules[i] = make([]*bool, q.modulesCount)
-		}
+		q.modules = utils.NewBitMatrix(q.modulesCount, q.modulesCount)
 		q.SetupPositionProbePattern(0, 0)
 		q.SetupPositionProbePattern(q.modulesCount-7, 0)
 		q.SetupPositionProbePattern(0, q.modulesCount-7)
 		q.SetupPositionAdjustPattern()
 		q.SetupTimingPattern()
 
-		precomputedQRBlanks[q.Version()] = Copy2DArray(q.modules)
+		storeBlank(q.Version(), q.modules)
 	}
 
 	q.SetupTypeInfo(test, maskPattern)
@@ -243,25 +611,46 @@ func (q *QRCode) MakeImpl(test bool, maskPattern int) {
 		q.SetupTypeNumber(test)
 	}
 
-	if q.dataCache == nil {
-		qrDataList := make([]*utils.QRData, len(q.DataList))
-		for i := range q.DataList {
-			qrDataList[i] = &q.DataList[i]
-		}
-		dataCache, err := utils.CreateData(q.Version(), q.errorCorrection, qrDataList)
-		if err != nil {
-			panic(err)
-		}
-		q.dataCache = make([]int, len(dataCache))
-		for i, b := range dataCache {
-			q.dataCache[i] = int(b)
-		}
+	if err := q.encodeData(); err != nil {
+		return err
 	}
 	dataCacheBytes := make([]byte, len(q.dataCache))
 	for i, v := range q.dataCache {
 		dataCacheBytes[i] = byte(v)
 	}
-	q.MapData(dataCacheBytes, maskPattern)
+	return q.MapData(dataCacheBytes, maskPattern)
+}
+
+// ensureVersion selects a version with BestFit if none is set.
+func (q *QRCode) ensureVersion() error {
+	if q.version != 0 {
+		return nil
+	}
+	_, err := q.BestFit(0)
+	return err
+}
+
+// encodeData fills the codeword cache if the data changed since the last build.
+func (q *QRCode) encodeData() error {
+	if q.dataCache != nil {
+		return nil
+	}
+	if err := q.ensureVersion(); err != nil {
+		return err
+	}
+	qrDataList := make([]*utils.QRData, len(q.DataList))
+	for i := range q.DataList {
+		qrDataList[i] = &q.DataList[i]
+	}
+	dataCache, err := utils.CreateData(q.Version(), q.usedErrorCorrection, qrDataList)
+	if err != nil {
+		return err
+	}
+	q.dataCache = make([]int, len(dataCache))
+	for i, b := range dataCache {
+		q.dataCache[i] = int(b)
+	}
+	return nil
 }
 
 func (q *QRCode) SetupTypeNumber(test bool) {
@@ -269,17 +658,17 @@ func (q *QRCode) SetupTypeNumber(test bool) {
 
 	for i := 0; i < 18; i++ {
 		mod := !test && ((bits>>i)&1) == 1
-		q.modules[i/3][i%3+q.modulesCount-8-3] = &mod
+		q.setFunctionModule(i/3, i%3+q.modulesCount-8-3, mod, utils.RoleVersionInfo)
 	}
 
 	for i := 0; i < 18; i++ {
 		mod := !test && ((bits>>i)&1) == 1
-		q.modules[i%3+q.modulesCount-8-3][i/3] = &mod
+		q.setFunctionModule(i%3+q.modulesCount-8-3, i/3, mod, utils.RoleVersionInfo)
 	}
 }
 
 func (q *QRCode) SetupTypeInfo(test bool, maskPattern int) {
-	data := (q.errorCorrection << 3) | maskPattern
+	data := q.usedErrorCorrection.FormatBits()<<3 | maskPattern
 	bits := utils.BCHTypeInfo(data)
 
 	// vertical
@@ -287,11 +676,11 @@ func (q *QRCode) SetupTypeInfo(test bool, maskPattern int) {
 		mod := !test && ((bits>>i)&1) == 1
 
 		if i < 6 {
-			q.modules[i][8] = &mod
+			q.setFunctionModule(i, 8, mod, utils.RoleFormatInfo)
 		} else if i < 8 {
-			q.modules[i+1][8] = &mod
+			q.setFunctionModule(i+1, 8, mod, utils.RoleFormatInfo)
 		} else {
-			q.modules[q.modulesCount-15+i][8] = &mod
+			q.setFunctionModule(q.modulesCount-15+i, 8, mod, utils.RoleFormatInfo)
 		}
 	}
 
@@ -300,34 +689,40 @@ func (q *QRCode) SetupTypeInfo(test bool, maskPattern int) {
 		mod := !test && ((bits>>i)&1) == 1
 
 		if i < 8 {
-			q.modules[8][q.modulesCount-i-1] = &mod
+			q.setFunctionModule(8, q.modulesCount-i-1, mod, utils.RoleFormatInfo)
 		} else if i < 9 {
-			q.modules[8][15-i-1+1] = &mod
+			q.setFunctionModule(8, 15-i-1+1, mod, utils.RoleFormatInfo)
 		} else {
-			q.modules[8][15-i-1] = &mod
+			q.setFunctionModule(8, 15-i-1, mod, utils.RoleFormatInfo)
 		}
 	}
 
 	// fixed module
-	mod := !test
-	q.modules[q.modulesCount-8][8] = &mod
+	q.setFunctionModule(q.modulesCount-8, 8, !test, utils.RoleDarkModule)
+}
+
+// setFunctionModule sets a function pattern module, recording its role when
+// a role map is being built.
+func (q *QRCode) setFunctionModule(row, col int, dark bool, role utils.ModuleRole) {
+	q.modules.SetFunction(row, col, dark)
+	if q.roles != nil {
+		q.roles.Set(row, col, role)
+	}
 }
 
 func (q *QRCode) SetupTimingPattern() {
 	for r := 8; r < q.modulesCount-8; r++ {
-		if q.modules[r][6] != nil {
+		if q.modules.IsFunction(r, 6) {
 			continue
 		}
-		val := r%2 == 0
-		q.modules[r][6] = &val
+		q.setFunctionModule(r, 6, r%2 == 0, utils.RoleTiming)
 	}
 
 	for c := 8; c < q.modulesCount-8; c++ {
-		if q.modules[6][c] != nil {
+		if q.modules.IsFunction(6, c) {
 			continue
 		}
-		val := c%2 == 0
-		q.modules[6][c] = &val
+		q.setFunctionModule(6, c, c%2 == 0, utils.RoleTiming)
 	}
 }
 
@@ -352,15 +747,14 @@ func (q *QRCode) isOutOfBounds(index int) bool {
 }
 
 func (q *QRCode) setModuleValue(row, col, r, c int) {
-	if (0 <= r && r <= 6 && (c == 0 || c == 6)) ||
+	dark := (0 <= r && r <= 6 && (c == 0 || c == 6)) ||
 		(0 <= c && c <= 6 && (r == 0 || r == 6)) ||
-		(2 <= r && r <= 4 && 2 <= c && c <= 4) {
-		val := true
-		q.modules[row][col] = &val
-	} else {
-		val := false
-		q.modules[row][col] = &val
+		(2 <= r && r <= 4 && 2 <= c && c <= 4)
+	role := utils.RoleFinder
+	if r == -1 || r == 7 || c == -1 || c == 7 {
+		role = utils.RoleSeparator
 	}
+	q.setFunctionModule(row, col, dark, role)
 }
 
 func (q *QRCode) SetupPositionAdjustPattern() {
@@ -372,7 +766,7 @@ func (q *QRCode) SetupPositionAdjustPattern() {
 		for j := range pos {
 			col := pos[j]
 
-			if q.modules[row][col] != nil {
+			if q.modules.IsFunction(row, col) {
 				continue
 			}
 
@@ -390,126 +784,137 @@ func (q *QRCode) setPositionAdjustPattern(row, col int) {
 }
 
 func (q *QRCode) setPositionAdjustPatternValue(row, col, r, c int) {
-	if r == -2 || r == 2 || c == -2 || c == 2 || (r == 0 && c == 0) {
-		val := true
-		q.modules[row+r][col+c] = &val
-	} else {
-		val := false
-		q.modules[row+r][col+c] = &val
-	}
+	dark := r == -2 || r == 2 || c == -2 || c == 2 || (r == 0 && c == 0)
+	q.setFunctionModule(row+r, col+c, dark, utils.RoleAlignment)
 }
 
-func (q *QRCode) BestFit(start int) int {
-	if !utils.CheckVersion(start) {
-		panic(fmt.Sprintf("Invalid version: %d", start))
+// BestFit selects the smallest version, not below start or the minimum
+// version, that holds the data at the requested error correction level. A
+// start of 0 searches from version 1. It returns a *utils.DataOverflowError
+// if the data does not fit the maximum version.
+func (q *QRCode) BestFit(start int) (int, error) {
+	if start != 0 && !utils.CheckVersion(start) {
+		return 0, &utils.InvalidVersionError{Version: start}
 	}
-
-	modeSizes := utils.ModeSizeVersion(start)
-	buffer := utils.NewBitBuffer()
-	for _, data := range q.DataList {
-		buffer.Put(data.GetMode(), 4)
-		buffer.Put(data.Len(), modeSizes[data.GetMode()])
-		data.Write(buffer)
+	start = max(start, q.minVersion, 1)
+	end := 40
+	if q.maxVersion != 0 {
+		end = q.maxVersion
 	}
 
-	// FIXME: This is a hack to work around the fact that the bisect_left function is not working as expected
-	// bisect := utils.BisectLeft(BIT_LIMIT_TABLE[q.errorCorrection], start)
-
-	if q.Version() == 41 {
-		panic("Data overflow error")
+	version, err := fitVersion(q.DataList, q.errorCorrection, start)
+	if err != nil {
+		return 0, err
 	}
-
-	// Now check whether we need more bits for the mode sizes, recursing if our guess was too low
-	status := reflect.DeepEqual(modeSizes, utils.ModeSizeVersion(q.Version()))
-	if !status {
-		q.BestFit(q.Version())
+	if version == 0 || version > end {
+		return 0, overflowError(q.DataList, q.errorCorrection, end)
 	}
-	return q.Version()
+	q.version = version
+	q.dataCache = nil
+	return version, nil
 }
 
-func (q *QRCode) BestMaskPattern() int {
-	minLostPoint := int(^uint(0) >> 1)
-	bestPattern := 0
-
-	for pattern := 0; pattern < 8; pattern++ {
-		q.MakeImpl(true, pattern)
-		lostPoint := utils.LostPoint(q.modules)
-
-		if pattern == 0 || minLostPoint > lostPoint {
-			minLostPoint = lostPoint
-			bestPattern = pattern
+// bitLength returns the number of bits the data list occupies in the given version.
+func bitLength(dataList []utils.QRData, version int) (int, error) {
+	buffer := utils.NewBitBuffer()
+	for i := range dataList {
+		if err := dataList[i].WriteSegment(buffer, version); err != nil {
+			return 0, err
 		}
 	}
-	return bestPattern
+	return buffer.Len(), nil
 }
 
-func (q *QRCode) PrintASCII(out *os.File, tty bool, invert bool) error {
-	if out == nil {
-		out = os.Stdout
+// overflowError reports the data list overflowing the version at the error
+// correction level.
+func overflowError(dataList []utils.QRData, errorCorrection constants.ErrorCorrectionLevel, version int) error {
+	length, err := bitLength(dataList, version)
+	if err != nil {
+		return err
 	}
+	return utils.NewDataOverflowError(length, BIT_LIMIT_TABLE[errorCorrection][version])
+}
 
-	if tty && !utils.OutIsTTY(out) {
-		return fmt.Errorf("not a tty")
+// fitVersion returns the smallest version from start upwards that holds the
+// data list, or 0 if none does. The bit length only changes where the
+// character count indicators grow, so it is recomputed at the start of each
+// ModeSizeVersion class.
+func fitVersion(dataList []utils.QRData, errorCorrection constants.ErrorCorrectionLevel, start int) (int, error) {
+	length := 0
+	for version := start; version <= 40; version++ {
+		if version == start || version == 10 || version == 27 {
+			var err error
+			if length, err = bitLength(dataList, version); err != nil {
+				return 0, err
+			}
+		}
+		if length <= BIT_LIMIT_TABLE[errorCorrection][version] {
+			return version, nil
+		}
 	}
+	return 0, nil
+}
 
-	if q.dataCache == nil {
-		q.Make(true)
+// BestMaskPattern returns the mask pattern with the lowest penalty score and
+// keeps the scores of all patterns for MaskScores. The patterns are built on
+// copies of the symbol and scored concurrently; ties go to the lowest pattern.
+func (q *QRCode) BestMaskPattern() (int, error) {
+	if err := q.encodeData(); err != nil {
+		return 0, err
 	}
 
-	modcount := q.modulesCount
-	codes := []string{"█", "▄", "▀", " "}
-
-	if tty {
-		invert = true
-	}
-	if invert {
-		codes = []string{" ", "▄", "▀", "█"}
+	scores := make([]utils.PenaltyScore, 8)
+	errs := make([]error, 8)
+	var wg sync.WaitGroup
+	for pattern := 0; pattern < 8; pattern++ {
+		wg.Add(1)
+		go func(pattern int) {
+			defer wg.Done()
+			// The copy shares the encoded data, which is only read from here on.
+			candidate := *q
+			if errs[pattern] = candidate.MakeImpl(true, pattern); errs[pattern] == nil {
+				scores[pattern] = utils.LostPointScore(candidate.modules)
+			}
+		}(pattern)
 	}
+	wg.Wait()
 
-	getModule := func(x, y int) int {
-		if invert && q.border > 0 && (x >= modcount+q.border || y >= modcount+q.border) {
-			return 1
-		}
-		if x < 0 || y < 0 || x >= modcount || y >= modcount {
-			return 0
+	minLostPoint := int(^uint(0) >> 1)
+	bestPattern := 0
+	for pattern := 0; pattern < 8; pattern++ {
+		if errs[pattern] != nil {
+			return 0, errs[pattern]
 		}
-		if q.modules[x][y] != nil && *q.modules[x][y] {
-			return 1
+		lostPoint := scores[pattern].Total()
+
+		if pattern == 0 || minLostPoint > lostPoint {
+			minLostPoint = lostPoint
+			bestPattern = pattern
 		}
-		return 0
 	}
+	q.maskScores = scores
+	return bestPattern, nil
+}
 
-	for r := -q.border; r < modcount+q.border; r += 2 {
-		if tty {
-			if !invert || r < modcount+q.border-1 {
-				fmt.Fprint(out, "\x1b[48;5;232m") // Background black
-			}
-			fmt.Fprint(out, "\x1b[38;5;255m") // Foreground white
-		}
-		for c := -q.border; c < modcount+q.border; c++ {
-			pos := getModule(r, c) + (getModule(r+1, c) << 1)
-			fmt.Fprint(out, codes[pos])
-		}
-		if tty {
-			fmt.Fprint(out, "\x1b[0m")
+func (q *QRCode) PrintASCII(out *os.File, tty bool, invert bool) error {
+	if q.dataCache == nil {
+		if err := q.Make(true); err != nil {
+			return err
 		}
-		fmt.Fprintln(out)
 	}
-
-	return nil
+	return printASCII(out, q.modules, q.border, tty, invert)
 }
 
+// MakeImage builds the symbol if needed and draws it. The colors and drawers
+// of imageFactory, or of the factory given to NewQRCode if imageFactory is the
+// zero value, are overridden by the options of New and by the "fill_color",
+// "back_color", "embedded_image" and "embedded_image_path" kwargs.
 func (q *QRCode) MakeImage(imageFactory image.PilImage, kwargs map[string]interface{}) (image.PilImage, error) {
-	if embeddedImagePath, ok := kwargs["embedded_image_path"]; ok && embeddedImagePath != nil {
-		if q.errorCorrection != constants.ERROR_CORRECT_H {
-			return image.PilImage{}, fmt.Errorf("Error correction level must be ERROR_CORRECT_H if an embedded image is provided")
-		}
-	}
-	if embeddedImage, ok := kwargs["embedded_image"]; ok && embeddedImage != nil {
-		if q.errorCorrection != constants.ERROR_CORRECT_H {
-			return image.PilImage{}, fmt.Errorf("Error correction level must be ERROR_CORRECT_H if an embedded image is provided")
-		}
+	embedded, err := kwargsStyle(kwargs)
+	if err != nil {
+		return image.PilImage{}, err
 	}
+	style := factoryStyle(imageFactory, q.imageFactory).over(q.style).over(embedded)
 
 	if err := CheckBoxSize(q.BoxSize); err != nil {
 		return image.PilImage{}, err
@@ -521,65 +926,44 @@ func (q *QRCode) MakeImage(imageFactory image.PilImage, kwargs map[string]interf
 		}
 	}
 
-	if reflect.ValueOf(imageFactory).IsNil() {
-		if !reflect.ValueOf(q.imageFactory).IsNil() {
-			imageFactory = q.imageFactory
-		} else {
-			imageFactory = *image.NewPilImage(q.border, q.modulesCount, q.BoxSize, nil, nil)
-		}
+	// The level is checked after Make, which may have boosted it to H.
+	if style.embeddedImage != nil && q.usedErrorCorrection != constants.ERROR_CORRECT_H {
+		return image.PilImage{}, fmt.Errorf("Error correction level must be ERROR_CORRECT_H if an embedded image is provided")
 	}
 
-	modules := make([][]bool, len(q.modules))
-	for i := range q.modules {
-		modules[i] = make([]bool, len(q.modules[i]))
-		for j := range q.modules[i] {
-			if q.modules[i][j] != nil {
-				modules[i][j] = *q.modules[i][j]
-			}
-		}
-	}
-	im := image.NewPilImage(q.border, q.modulesCount, q.BoxSize, modules, nil)
-
-	if im.NeedsDrawRect {
-		for r := 0; r < q.modulesCount; r++ {
-			for c := 0; c < q.modulesCount; c++ {
-				if q.modules[r][c] != nil && *q.modules[r][c] {
-					if im.NeedsContext {
-						im.DrawRectContext(r, c, q)
-					} else {
-						im.DrawRect(r, c)
-					}
-				}
-			}
-		}
-	}
-
-	if im.NeedsProcessing {
-		im.Process()
-	}
-
-	return *im, nil
+	return makeImage(q.modules, q.RoleMap(), q.border, q.BoxSize, q, style, kwargs), nil
 }
 
 func (q *QRCode) IsConstrained(row, col int) bool {
-	return row >= 0 &&
-		row < len(q.modules) &&
-		col >= 0 &&
-		col < len(q.modules[row])
+	return q.modules.InBounds(row, col)
 }
 
-func (q *QRCode) MapData(data []byte, maskPattern int) {
+func (q *QRCode) MapData(data []byte, maskPattern int) error {
 	inc := -1
 	row := q.modulesCount - 1
 	bitIndex := 7
 	byteIndex := 0
 
-	maskFunc := utils.MaskFunc(maskPattern)
+	maskFunc, err := utils.MaskFunc(maskPattern)
+	if err != nil {
+		return err
+	}
 
 	dataLen := len(data)
 
+	dataCodewords := 0
+	if q.roles != nil {
+		rsBlocks, err := base.RSBlocks(q.version, q.usedErrorCorrection)
+		if err != nil {
+			return err
+		}
+		for _, block := range rsBlocks {
+			dataCodewords += block.DataCount
+		}
+	}
+
 	for col := q.modulesCount - 1; col > 0; col -= 2 {
-		if col <= 6 {
+		if col == 6 {
 			col--
 		}
 
@@ -587,7 +971,7 @@ func (q *QRCode) MapData(data []byte, maskPattern int) {
 
 		for {
 			for _, c := range colRange {
-				if q.modules[row][c] == nil {
+				if !q.modules.IsFunction(row, c) {
 					dark := false
 
 					if byteIndex < dataLen {
@@ -598,7 +982,10 @@ func (q *QRCode) MapData(data []byte, maskPattern int) {
 						dark = !dark
 					}
 
-					q.modules[row][c] = &dark
+					q.modules.Set(row, c, dark)
+					if q.roles != nil {
+						q.roles.Set(row, c, codewordRole(byteIndex, dataCodewords, dataLen))
+					}
 					bitIndex--
 
 					if bitIndex == -1 {
@@ -617,51 +1004,48 @@ func (q *QRCode) MapData(data []byte, maskPattern int) {
 			}
 		}
 	}
+	return nil
 }
 
-func (q *QRCode) GetMatrix() [][]bool {
-	if q.dataCache == nil {
-		q.Make(true)
+// codewordRole returns the role of the modules of the codeword at index.
+func codewordRole(index, dataCodewords, totalCodewords int) utils.ModuleRole {
+	switch {
+	case index < dataCodewords:
+		return utils.RoleData
+	case index < totalCodewords:
+		return utils.RoleErrorCorrection
 	}
+	return utils.RoleRemainder
+}
 
-	if q.border == 0 {
-		matrix := make([][]bool, len(q.modules))
-		for i, row := range q.modules {
-			matrix[i] = make([]bool, len(row))
-			for j, cell := range row {
-				if cell != nil {
-					matrix[i][j] = *cell
-				}
-			}
-		}
-		return matrix
+// RoleMap classifies every module of the symbol built by Make, using the same
+// placement as the build itself. It returns nil before the symbol is built.
+func (q *QRCode) RoleMap() *utils.RoleMap {
+	if q.dataCache == nil || q.modulesCount == 0 {
+		return nil
 	}
-
-	width := len(q.modules) + q.border*2
-	code := make([][]bool, width)
-	for i := 0; i < q.border; i++ {
-		code[i] = make([]bool, width)
-		code[width-1-i] = make([]bool, width)
+	candidate := *q
+	candidate.roles = utils.NewRoleMap(q.modulesCount, q.modulesCount)
+	if err := candidate.MakeImpl(true, 0); err != nil {
+		return nil
 	}
+	return candidate.roles
+}
 
-	for i, module := range q.modules {
-		row := make([]bool, width)
-		for j, cell := range module {
-			if cell != nil {
-				row[j+q.border] = *cell
-			}
+func (q *QRCode) GetMatrix() ([][]bool, error) {
+	if q.dataCache == nil {
+		if err := q.Make(true); err != nil {
+			return nil, err
 		}
-		code[i+q.border] = row
 	}
-
-	return code
+	return matrixWithBorder(q.modules, q.border), nil
 }
 
 func (q *QRCode) ActiveWithNeighbors(row, col int) ActiveWithNeighbors {
 	context := make([]bool, 0, 9)
 	for r := row - 1; r <= row+1; r++ {
 		for c := col - 1; c <= col+1; c++ {
-			context = append(context, q.IsConstrained(r, c) && q.modules[r][c] != nil && *q.modules[r][c])
+			context = append(context, q.modules.Get(r, c))
 		}
 	}
 	return ActiveWithNeighbors{
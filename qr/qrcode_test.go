@@ -0,0 +1,314 @@
+package qr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"qrcode/constants"
+	"qrcode/image"
+	"qrcode/utils"
+)
+
+// symbolResult is what concurrent builds of a symbol must agree on.
+type symbolResult struct {
+	matrix [][]bool
+	trace  *Trace
+	roles  *utils.RoleMap
+}
+
+type symbolJob struct {
+	name  string
+	build func() (symbolResult, error)
+}
+
+func qrJob(version int, data string, maskPattern int) symbolJob {
+	return symbolJob{
+		name: "qr/" + data[:min(len(data), 8)],
+		build: func() (symbolResult, error) {
+			q, err := NewQRCode(version, constants.ERROR_CORRECT_M, 1, 4, image.PilImage{}, maskPattern)
+			if err != nil {
+				return symbolResult{}, err
+			}
+			if err := q.AddData(data, 0); err != nil {
+				return symbolResult{}, err
+			}
+			matrix, err := q.GetMatrix()
+			if err != nil {
+				return symbolResult{}, err
+			}
+			trace, err := q.Trace()
+			if err != nil {
+				return symbolResult{}, err
+			}
+			return symbolResult{matrix: matrix, trace: trace, roles: q.RoleMap()}, nil
+		},
+	}
+}
+
+func microJob(data string) symbolJob {
+	return symbolJob{
+		name: "micro/" + data,
+		build: func() (symbolResult, error) {
+			q, err := NewMicroQRCode(0, constants.ERROR_CORRECT_L, 1, 2, image.PilImage{}, MaskAuto)
+			if err != nil {
+				return symbolResult{}, err
+			}
+			if err := q.AddData(data, 0); err != nil {
+				return symbolResult{}, err
+			}
+			matrix, err := q.GetMatrix()
+			return symbolResult{matrix: matrix}, err
+		},
+	}
+}
+
+func rmqrJob(data string) symbolJob {
+	return symbolJob{
+		name: "rmqr/" + data,
+		build: func() (symbolResult, error) {
+			q, err := NewRMQRCode(0, constants.ERROR_CORRECT_M, 1, 2, image.PilImage{})
+			if err != nil {
+				return symbolResult{}, err
+			}
+			if err := q.AddData(data, 0); err != nil {
+				return symbolResult{}, err
+			}
+			matrix, err := q.GetMatrix()
+			return symbolResult{matrix: matrix}, err
+		},
+	}
+}
+
+// TestConcurrentBuilds builds symbols of every type from many goroutines
+// while the shared blank cache is warm. Run it with -race.
+func TestConcurrentBuilds(t *testing.T) {
+	jobs := []symbolJob{
+		qrJob(0, "HELLO WORLD", MaskAuto),
+		qrJob(0, strings.Repeat("0123456789", 30), MaskAuto),
+		qrJob(7, "version 7 carries version information", 3),
+		qrJob(25, strings.Repeat("shared blank cache ", 20), MaskAuto),
+		microJob("12345"),
+		microJob("HELLO"),
+		rmqrJob("rMQR 123"),
+		rmqrJob(strings.Repeat("ABC", 20)),
+	}
+
+	// The sequential builds also fill the blank cache.
+	want := make([]symbolResult, len(jobs))
+	for i, job := range jobs {
+		result, err := job.build()
+		if err != nil {
+			t.Fatalf("%s: %v", job.name, err)
+		}
+		want[i] = result
+	}
+
+	const workers = 8
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, job := range jobs {
+				got, err := job.build()
+				if err != nil {
+					t.Errorf("%s: %v", job.name, err)
+					continue
+				}
+				if !reflect.DeepEqual(got, want[i]) {
+					t.Errorf("%s: concurrent build differs from the sequential build", job.name)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// naivePenalty scores a masked symbol by checking every run, block and
+// window of the rules directly, as written in the specification.
+func naivePenalty(m [][]bool) utils.PenaltyScore {
+	n := len(m)
+	at := func(transpose bool, i, j int) bool {
+		if transpose {
+			return m[j][i]
+		}
+		return m[i][j]
+	}
+	finder := []bool{true, false, true, true, true, false, true}
+	light := []bool{false, false, false, false}
+	patterns := [][]bool{append(append([]bool{}, finder...), light...), append(append([]bool{}, light...), finder...)}
+
+	var score utils.PenaltyScore
+	for _, transpose := range []bool{false, true} {
+		for i := 0; i < n; i++ {
+			// N1: a run of k >= 5 same colored modules scores 3 + (k - 5).
+			for j := 0; j < n; {
+				k := j
+				for k < n && at(transpose, i, k) == at(transpose, i, j) {
+					k++
+				}
+				if k-j >= 5 {
+					score.N1 += 3 + (k - j - 5)
+				}
+				j = k
+			}
+			// N3: 1:1:3:1:1 with four light modules on one side scores 40.
+			for j := 0; j+11 <= n; j++ {
+				for _, pattern := range patterns {
+					match := true
+					for k, dark := range pattern {
+						if at(transpose, i, j+k) != dark {
+							match = false
+							break
+						}
+					}
+					if match {
+						score.N3 += 40
+					}
+				}
+			}
+		}
+	}
+	// N2: every 2x2 block of one color scores 3.
+	for i := 0; i+1 < n; i++ {
+		for j := 0; j+1 < n; j++ {
+			if m[i][j] == m[i][j+1] && m[i][j] == m[i+1][j] && m[i][j] == m[i+1][j+1] {
+				score.N2 += 3
+			}
+		}
+	}
+	// N4: 10 for each full 5% the dark share deviates from 50%.
+	dark := 0
+	for _, row := range m {
+		for _, d := range row {
+			if d {
+				dark++
+			}
+		}
+	}
+	deviation := dark*100 - 50*n*n
+	if deviation < 0 {
+		deviation = -deviation
+	}
+	score.N4 = deviation / (5 * n * n) * 10
+	return score
+}
+
+// TestMaskSelection checks the penalty scores of every mask against
+// naivePenalty and pins them, with the chosen mask, for a fixed input.
+func TestMaskSelection(t *testing.T) {
+	q, err := NewQRCode(7, constants.ERROR_CORRECT_M, 1, 0, image.PilImage{}, MaskAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.AddData("penalty rules N1 N2 N3 N4", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Make(false); err != nil {
+		t.Fatal(err)
+	}
+
+	scores := q.MaskScores()
+	if len(scores) != 8 {
+		t.Fatalf("got %d mask scores, want 8", len(scores))
+	}
+	best, bestTotal := 0, 0
+	for pattern := 0; pattern < 8; pattern++ {
+		candidate := *q
+		if err := candidate.MakeImpl(true, pattern); err != nil {
+			t.Fatal(err)
+		}
+		want := naivePenalty(matrixWithBorder(candidate.modules, 0))
+		if scores[pattern] != want {
+			t.Errorf("mask %d: got %+v, naive reference %+v", pattern, scores[pattern], want)
+		}
+		if pattern == 0 || want.Total() < bestTotal {
+			best, bestTotal = pattern, want.Total()
+		}
+	}
+	if q.usedMaskPattern != best {
+		t.Errorf("chose mask %d, want %d", q.usedMaskPattern, best)
+	}
+
+	pinned := []utils.PenaltyScore{
+		{N1: 600, N2: 699, N3: 560},
+		{N1: 715, N2: 840, N3: 440},
+		{N1: 705, N2: 720, N3: 560},
+		{N1: 679, N2: 750, N3: 400},
+		{N1: 582, N2: 825, N3: 360},
+		{N1: 698, N2: 813, N3: 400},
+		{N1: 609, N2: 795, N3: 320},
+		{N1: 632, N2: 900, N3: 480},
+	}
+	if !reflect.DeepEqual(scores, pinned) {
+		t.Errorf("got scores %+v, want %+v", scores, pinned)
+	}
+	if q.usedMaskPattern != 6 {
+		t.Errorf("chose mask %d, want 6", q.usedMaskPattern)
+	}
+}
+
+func BenchmarkMake(b *testing.B) {
+	for _, version := range []int{10, 25, 40} {
+		b.Run(fmt.Sprintf("version=%d", version), func(b *testing.B) {
+			capacity, err := Capacity(utils.ModeByte, version, constants.ERROR_CORRECT_M)
+			if err != nil {
+				b.Fatal(err)
+			}
+			data := strings.Repeat("benchmark", capacity/9+1)[:capacity]
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				q, err := NewQRCode(version, constants.ERROR_CORRECT_M, 1, 4, image.PilImage{}, MaskAuto)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := q.AddData(data, 0); err != nil {
+					b.Fatal(err)
+				}
+				if err := q.Make(false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestMakeErrorCorrectionKwarg(t *testing.T) {
+	for _, level := range []any{nil, constants.ERROR_CORRECT_Q, "H", "l"} {
+		if _, err := Make("kwargs", map[string]interface{}{"error_correction": level}); err != nil {
+			t.Errorf("error_correction %v: %v", level, err)
+		}
+	}
+	// Ints used the format bit values before the levels were renumbered, so
+	// they are ambiguous and rejected.
+	for _, level := range []any{0, 1, int(constants.ERROR_CORRECT_M), "X", 1.0} {
+		if _, err := Make("kwargs", map[string]interface{}{"error_correction": level}); err == nil {
+			t.Errorf("error_correction %v (%T) was accepted", level, level)
+		}
+	}
+}
+
+func TestBitLimitTable(t *testing.T) {
+	// Data capacities of ISO/IEC 18004 Table 7, in bits.
+	tests := []struct {
+		errorCorrection constants.ErrorCorrectionLevel
+		version1        int
+		version40       int
+	}{
+		{constants.ERROR_CORRECT_L, 152, 23648},
+		{constants.ERROR_CORRECT_M, 128, 18672},
+		{constants.ERROR_CORRECT_Q, 104, 13328},
+		{constants.ERROR_CORRECT_H, 72, 10208},
+	}
+	for _, tt := range tests {
+		if got := BIT_LIMIT_TABLE[tt.errorCorrection][1]; got != tt.version1 {
+			t.Errorf("1-%s: got %d bits, want %d", tt.errorCorrection, got, tt.version1)
+		}
+		if got := BIT_LIMIT_TABLE[tt.errorCorrection][40]; got != tt.version40 {
+			t.Errorf("40-%s: got %d bits, want %d", tt.errorCorrection, got, tt.version40)
+		}
+	}
+}
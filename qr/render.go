@@ -0,0 +1,204 @@
+package qr
+
+import (
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"io"
+	"os"
+	"qrcode/image"
+	"qrcode/image/styles/moduledrawers"
+	"qrcode/utils"
+)
+
+// printASCII writes the modules surrounded by a quiet zone of border modules,
+// packing two rows into each line of text.
+func printASCII(out io.Writer, modules *utils.BitMatrix, border int, tty bool, invert bool) error {
+	if f, ok := out.(*os.File); out == nil || ok && f == nil {
+		out = os.Stdout
+	}
+
+	if tty {
+		if f, ok := out.(*os.File); !ok || !utils.OutIsTTY(f) {
+			return fmt.Errorf("not a tty")
+		}
+	}
+
+	height := modules.Height()
+	width := modules.Width()
+	codes := []string{"█", "▄", "▀", " "}
+
+	if tty {
+		invert = true
+	}
+	if invert {
+		codes = []string{" ", "▄", "▀", "█"}
+	}
+
+	getModule := func(x, y int) int {
+		if invert && border > 0 && (x >= height+border || y >= width+border) {
+			return 1
+		}
+		if modules.Get(x, y) {
+			return 1
+		}
+		return 0
+	}
+
+	for r := -border; r < height+border; r += 2 {
+		if tty {
+			if !invert || r < height+border-1 {
+				fmt.Fprint(out, "\x1b[48;5;232m") // Background black
+			}
+			fmt.Fprint(out, "\x1b[38;5;255m") // Foreground white
+		}
+		for c := -border; c < width+border; c++ {
+			pos := getModule(r, c) + (getModule(r+1, c) << 1)
+			fmt.Fprint(out, codes[pos])
+		}
+		if tty {
+			fmt.Fprint(out, "\x1b[0m")
+		}
+		fmt.Fprintln(out)
+	}
+
+	return nil
+}
+
+// matrixWithBorder returns the modules as booleans surrounded by border light modules.
+func matrixWithBorder(modules *utils.BitMatrix, border int) [][]bool {
+	height := modules.Height()
+	width := modules.Width()
+
+	code := make([][]bool, height+border*2)
+	for r := range code {
+		code[r] = make([]bool, width+border*2)
+	}
+	for r := 0; r < height; r++ {
+		for c := 0; c < width; c++ {
+			code[r+border][c+border] = modules.Get(r, c)
+		}
+	}
+	return code
+}
+
+// imageStyle holds how makeImage draws a symbol. Zero values draw black
+// square modules on white.
+type imageStyle struct {
+	fillColor     color.Color
+	backColor     color.Color
+	moduleDrawer  moduledrawers.QRModuleDrawer
+	eyeDrawer     moduledrawers.QRModuleDrawer
+	embeddedImage stdimage.Image
+}
+
+// over returns the style with the colors and drawers of s replaced by those
+// set in top.
+func (s imageStyle) over(top imageStyle) imageStyle {
+	if top.fillColor != nil {
+		s.fillColor = top.fillColor
+	}
+	if top.backColor != nil {
+		s.backColor = top.backColor
+	}
+	if top.moduleDrawer != nil || top.eyeDrawer != nil {
+		s.moduleDrawer, s.eyeDrawer = top.moduleDrawer, top.eyeDrawer
+	}
+	if top.embeddedImage != nil {
+		s.embeddedImage = top.embeddedImage
+	}
+	return s
+}
+
+// factoryStyle returns the colors and drawers of the image factory, or of
+// fallback if factory is the zero value.
+func factoryStyle(factory, fallback image.PilImage) imageStyle {
+	if factory.Canvas() == nil {
+		factory = fallback
+	}
+	if factory.Canvas() == nil {
+		return imageStyle{}
+	}
+	module, eye := factory.Drawers()
+	return imageStyle{
+		fillColor:    factory.FillColor(),
+		backColor:    factory.BackColor(),
+		moduleDrawer: module,
+		eyeDrawer:    eye,
+	}
+}
+
+// kwargsStyle reads the "embedded_image" (an image.Image) and
+// "embedded_image_path" kwargs. The "fill_color" and "back_color" kwargs are
+// applied by the image itself.
+func kwargsStyle(kwargs map[string]interface{}) (imageStyle, error) {
+	var style imageStyle
+	if arg, ok := kwargs["embedded_image"]; ok && arg != nil {
+		img, ok := arg.(stdimage.Image)
+		if !ok {
+			return imageStyle{}, fmt.Errorf("Invalid embedded_image: %T", arg)
+		}
+		style.embeddedImage = img
+	}
+	if arg, ok := kwargs["embedded_image_path"]; ok && arg != nil {
+		path, ok := arg.(string)
+		if !ok {
+			return imageStyle{}, fmt.Errorf("Invalid embedded_image_path: %T", arg)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return imageStyle{}, err
+		}
+		defer f.Close()
+		img, _, err := stdimage.Decode(f)
+		if err != nil {
+			return imageStyle{}, fmt.Errorf("Invalid embedded_image_path: %w", err)
+		}
+		style.embeddedImage = img
+	}
+	return style, nil
+}
+
+// makeImage draws the dark modules in the given style. Colors set in kwargs
+// take precedence over those of the style. context is handed to drawers that
+// need to look at neighbouring modules, and roles, if not nil, tells them
+// what each module is used for.
+func makeImage(modules *utils.BitMatrix, roles *utils.RoleMap, border, boxSize int, context any, style imageStyle, kwargs map[string]interface{}) image.PilImage {
+	matrix := matrixWithBorder(modules, 0)
+	im := image.NewRectPilImage(border, modules.Width(), modules.Height(), boxSize, matrix, kwargs)
+	im.SetRoleMap(roles)
+	if kwargs["fill_color"] != nil {
+		style.fillColor = nil
+	}
+	if kwargs["back_color"] != nil {
+		style.backColor = nil
+	}
+	im.SetColors(style.fillColor, style.backColor)
+	if style.moduleDrawer != nil || style.eyeDrawer != nil {
+		im.SetDrawers(style.moduleDrawer, style.eyeDrawer)
+	}
+
+	if im.NeedsDrawRect {
+		for r := range matrix {
+			for c := range matrix[r] {
+				if matrix[r][c] {
+					if im.NeedsContext {
+						im.DrawRectContext(r, c, context)
+					} else {
+						im.DrawRect(r, c)
+					}
+				}
+			}
+		}
+	}
+
+	if im.NeedsProcessing {
+		im.Process()
+	}
+
+	if style.embeddedImage != nil {
+		im.EmbedImage(style.embeddedImage)
+	}
+
+	return *im
+}
@@ -0,0 +1,404 @@
+package qr
+
+import (
+	"fmt"
+	"os"
+	"qrcode/base"
+	"qrcode/constants"
+	"qrcode/image"
+	"qrcode/utils"
+)
+
+// RMQR_QUIET_ZONE is the quiet zone rMQR symbols need.
+const RMQR_QUIET_ZONE = 2
+
+// RMQRCode builds rectangular Micro QR (rMQR) symbols R7x43-R17x139.
+// Versions are numbered from 1 in the order of utils.RMQRSizes, and 0
+// selects the smallest symbol area that holds the data. rMQR supports the
+// error correction levels M and H.
+type RMQRCode struct {
+	modules         *utils.BitMatrix
+	height          int
+	width           int
+	version         int
+	errorCorrection constants.ErrorCorrectionLevel
+	BoxSize         int
+	border          int
+	imageFactory    image.PilImage
+	DataList        []utils.QRData
+	dataCache       []byte
+	roles           *utils.RoleMap
+}
+
+func NewRMQRCode(version int, errorCorrection constants.ErrorCorrectionLevel, boxSize, border int, imageFactory image.PilImage) (*RMQRCode, error) {
+	if err := CheckBoxSize(boxSize); err != nil {
+		return nil, err
+	}
+	if err := CheckBorder(border); err != nil {
+		return nil, err
+	}
+	if version != 0 && !utils.CheckRMQRVersion(version) {
+		return nil, &utils.InvalidVersionError{Version: version}
+	}
+	if _, ok := base.RMQR_RS_BLOCK_OFFSET[errorCorrection]; !ok {
+		return nil, fmt.Errorf("rMQR only supports error correction levels M and H: %w", &utils.InvalidErrorCorrectionError{Level: errorCorrection})
+	}
+
+	q := &RMQRCode{
+		version:         version,
+		errorCorrection: errorCorrection,
+		BoxSize:         boxSize,
+		border:          border,
+		imageFactory:    imageFactory,
+	}
+	q.Clear()
+	return q, nil
+}
+
+func (q *RMQRCode) Clear() {
+	// Reset the internal data
+	q.modules = utils.NewBitMatrix(0, 0)
+	q.height = 0
+	q.width = 0
+	q.dataCache = nil
+	q.DataList = make([]utils.QRData, 0)
+}
+
+func (q *RMQRCode) Version() int {
+	return q.version
+}
+
+// Size returns the height and width of the symbol version.
+func (q *RMQRCode) Size() utils.RMQRSize {
+	if !utils.CheckRMQRVersion(q.version) {
+		return utils.RMQRSize{}
+	}
+	return utils.RMQRSizes[q.version-1]
+}
+
+func (q *RMQRCode) AddData(data any, optimize int) error {
+	if optimize < 0 {
+		return fmt.Errorf("Invalid optimize value: %d", optimize)
+	}
+
+	switch v := data.(type) {
+	case utils.QRData:
+		q.DataList = append(q.DataList, v)
+	case string:
+		qrData, err := utils.NewQRData([]byte(v), 0, true)
+		if err != nil {
+			return err
+		}
+		q.DataList = append(q.DataList, *qrData)
+	default:
+		return fmt.Errorf("Unsupported data type: %T", v)
+	}
+
+	q.dataCache = nil
+	return nil
+}
+
+// BestFit selects the version with the smallest area that holds the data at
+// the error correction level.
+func (q *RMQRCode) BestFit() (int, error) {
+	best, required, available := 0, 0, 0
+	for version := 1; version <= len(utils.RMQRSizes); version++ {
+		rsBlocks, err := base.RMQRRSBlocks(version, q.errorCorrection)
+		if err != nil {
+			return 0, err
+		}
+		bitLimit := 0
+		for _, block := range rsBlocks {
+			bitLimit += block.DataCount * 8
+		}
+
+		buffer := utils.NewBitBuffer()
+		for i := range q.DataList {
+			if err := q.DataList[i].WriteRMQRSegment(buffer, version); err != nil {
+				return 0, err
+			}
+		}
+		if buffer.Len() > bitLimit {
+			if bitLimit > available {
+				required, available = buffer.Len(), bitLimit
+			}
+			continue
+		}
+
+		size := utils.RMQRSizes[version-1]
+		if best == 0 || size.Height*size.Width < utils.RMQRSizes[best-1].Height*utils.RMQRSizes[best-1].Width {
+			best = version
+		}
+	}
+	if best == 0 {
+		return 0, utils.NewDataOverflowError(required, available)
+	}
+	q.version = best
+	q.dataCache = nil
+	return best, nil
+}
+
+func (q *RMQRCode) Make(fit bool) error {
+	if fit || q.version == 0 {
+		if _, err := q.BestFit(); err != nil {
+			return err
+		}
+	}
+	return q.MakeImpl()
+}
+
+func (q *RMQRCode) MakeImpl() error {
+	if !utils.CheckRMQRVersion(q.version) {
+		return &utils.InvalidVersionError{Version: q.version}
+	}
+	size := q.Size()
+	q.height = size.Height
+	q.width = size.Width
+
+	q.modules = utils.NewBitMatrix(q.width, q.height)
+	q.SetupPositionProbePattern()
+	q.SetupSubFinderPattern()
+	q.SetupCornerPattern()
+	q.SetupPositionAdjustPattern()
+	q.SetupTimingPattern()
+	q.SetupTypeInfo()
+
+	if q.dataCache == nil {
+		qrDataList := make([]*utils.QRData, len(q.DataList))
+		for i := range q.DataList {
+			qrDataList[i] = &q.DataList[i]
+		}
+		dataCache, err := utils.CreateRMQRData(q.version, q.errorCorrection, qrDataList)
+		if err != nil {
+			return err
+		}
+		q.dataCache = dataCache
+	}
+	return q.MapData(q.dataCache)
+}
+
+func (q *RMQRCode) setModule(row, col int, dark bool, role utils.ModuleRole) {
+	if q.modules.InBounds(row, col) {
+		q.modules.SetFunction(row, col, dark)
+		if q.roles != nil {
+			q.roles.Set(row, col, role)
+		}
+	}
+}
+
+// SetupPositionProbePattern places the finder pattern in the top left
+// corner with its separator on the right and, if there is room, below.
+func (q *RMQRCode) SetupPositionProbePattern() {
+	for r := 0; r <= 7; r++ {
+		for c := 0; c <= 7; c++ {
+			val := (r <= 6 && c <= 6) &&
+				(r == 0 || r == 6 || c == 0 || c == 6 || (2 <= r && r <= 4 && 2 <= c && c <= 4))
+			role := utils.RoleFinder
+			if r == 7 || c == 7 {
+				role = utils.RoleSeparator
+			}
+			q.setModule(r, c, val, role)
+		}
+	}
+}
+
+// SetupSubFinderPattern places the 5x5 sub-finder pattern in the bottom right corner.
+func (q *RMQRCode) SetupSubFinderPattern() {
+	for r := -2; r <= 2; r++ {
+		for c := -2; c <= 2; c++ {
+			val := r == -2 || r == 2 || c == -2 || c == 2 || (r == 0 && c == 0)
+			q.setModule(q.height-3+r, q.width-3+c, val, utils.RoleFinder)
+		}
+	}
+}
+
+// SetupCornerPattern places the corner finder patterns in the top right and,
+// when the finder pattern does not reach it, the bottom left corner. They only
+// help to locate the symbol and are not drawn as eyes.
+func (q *RMQRCode) SetupCornerPattern() {
+	for c := q.width - 3; c < q.width; c++ {
+		q.setModule(0, c, true, utils.RoleAlignment)
+	}
+	q.setModule(1, q.width-2, false, utils.RoleAlignment)
+	q.setModule(1, q.width-1, true, utils.RoleAlignment)
+
+	if q.height <= 7 {
+		return
+	}
+	for c := 0; c < 3; c++ {
+		q.setModule(q.height-1, c, true, utils.RoleAlignment)
+	}
+	if q.height > 9 {
+		q.setModule(q.height-2, 0, true, utils.RoleAlignment)
+		q.setModule(q.height-2, 1, false, utils.RoleAlignment)
+	}
+}
+
+// SetupPositionAdjustPattern places the 3x3 alignment patterns on the top
+// and bottom edges of each alignment column.
+func (q *RMQRCode) SetupPositionAdjustPattern() {
+	for _, col := range utils.RMQRAlignmentColumns[q.width] {
+		for _, row := range []int{1, q.height - 2} {
+			for r := -1; r <= 1; r++ {
+				for c := -1; c <= 1; c++ {
+					q.setModule(row+r, col+c, r != 0 || c != 0, utils.RoleAlignment)
+				}
+			}
+		}
+	}
+}
+
+// SetupTimingPattern fills the top and bottom rows, the outer columns and the
+// alignment columns with alternating modules.
+func (q *RMQRCode) SetupTimingPattern() {
+	for _, r := range []int{0, q.height - 1} {
+		for c := 0; c < q.width; c++ {
+			if !q.modules.IsFunction(r, c) {
+				q.setModule(r, c, c%2 == 0, utils.RoleTiming)
+			}
+		}
+	}
+
+	cols := append([]int{0, q.width - 1}, utils.RMQRAlignmentColumns[q.width]...)
+	for _, c := range cols {
+		for r := 0; r < q.height; r++ {
+			if !q.modules.IsFunction(r, c) {
+				q.setModule(r, c, r%2 == 0, utils.RoleTiming)
+			}
+		}
+	}
+}
+
+// SetupTypeInfo places the format information next to the finder and the sub-finder pattern.
+func (q *RMQRCode) SetupTypeInfo() {
+	level := 0
+	if q.errorCorrection == constants.ERROR_CORRECT_H {
+		level = 1
+	}
+	bits := utils.BCHRMQRFormatInfo(level<<5 | (q.version - 1))
+
+	finderBits := bits ^ utils.RMQR_FINDER_MASK
+	for i := 0; i < 18; i++ {
+		q.setModule(1+i%5, 8+i/5, (finderBits>>i)&1 == 1, utils.RoleFormatInfo)
+	}
+
+	subFinderBits := bits ^ utils.RMQR_SUB_FINDER_MASK
+	for i := 0; i < 15; i++ {
+		q.setModule(q.height-6+i%5, q.width-8+i/5, (subFinderBits>>i)&1 == 1, utils.RoleFormatInfo)
+	}
+	for i := 15; i < 18; i++ {
+		q.setModule(q.height-6, q.width-5+i-15, (subFinderBits>>i)&1 == 1, utils.RoleFormatInfo)
+	}
+}
+
+// MapData places the codewords in two module wide columns from the right
+// edge, masking every data and remainder module.
+func (q *RMQRCode) MapData(data []byte) error {
+	maskFunc, err := utils.MaskFunc(utils.RMQR_MASK_PATTERN)
+	if err != nil {
+		return err
+	}
+	inc := -1
+	row := q.height - 1
+	bitIndex := 7
+	byteIndex := 0
+
+	dataCodewords := 0
+	if q.roles != nil {
+		rsBlocks, err := base.RMQRRSBlocks(q.version, q.errorCorrection)
+		if err != nil {
+			return err
+		}
+		for _, block := range rsBlocks {
+			dataCodewords += block.DataCount
+		}
+	}
+
+	for col := q.width - 2; col > 0; col -= 2 {
+		for {
+			for _, c := range []int{col, col - 1} {
+				if !q.modules.IsFunction(row, c) {
+					dark := false
+
+					if byteIndex < len(data) {
+						dark = ((data[byteIndex] >> bitIndex) & 1) == 1
+					}
+
+					if maskFunc(row, c) {
+						dark = !dark
+					}
+
+					q.modules.Set(row, c, dark)
+					if q.roles != nil {
+						q.roles.Set(row, c, codewordRole(byteIndex, dataCodewords, len(data)))
+					}
+					bitIndex--
+
+					if bitIndex == -1 {
+						byteIndex++
+						bitIndex = 7
+					}
+				}
+			}
+
+			row += inc
+
+			if row < 0 || row >= q.height {
+				row -= inc
+				inc = -inc
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (q *RMQRCode) PrintASCII(out *os.File, tty bool, invert bool) error {
+	if q.dataCache == nil {
+		if err := q.Make(true); err != nil {
+			return err
+		}
+	}
+	return printASCII(out, q.modules, q.border, tty, invert)
+}
+
+// MakeImage builds the symbol if needed and draws it with the colors and
+// drawers of imageFactory, or of the factory given to NewRMQRCode if
+// imageFactory is the zero value. The "fill_color" and "back_color" kwargs
+// override the factory colors.
+func (q *RMQRCode) MakeImage(imageFactory image.PilImage, kwargs map[string]interface{}) (image.PilImage, error) {
+	if err := CheckBoxSize(q.BoxSize); err != nil {
+		return image.PilImage{}, err
+	}
+
+	if q.dataCache == nil {
+		if err := q.Make(true); err != nil {
+			return image.PilImage{}, err
+		}
+	}
+
+	return makeImage(q.modules, q.RoleMap(), q.border, q.BoxSize, q, factoryStyle(imageFactory, q.imageFactory), kwargs), nil
+}
+
+// RoleMap classifies every module of the symbol built by Make, using the same
+// placement as the build itself. It returns nil before the symbol is built.
+func (q *RMQRCode) RoleMap() *utils.RoleMap {
+	if q.dataCache == nil || q.width == 0 {
+		return nil
+	}
+	candidate := *q
+	candidate.roles = utils.NewRoleMap(q.width, q.height)
+	if err := candidate.MakeImpl(); err != nil {
+		return nil
+	}
+	return candidate.roles
+}
+
+func (q *RMQRCode) GetMatrix() ([][]bool, error) {
+	if q.dataCache == nil {
+		if err := q.Make(true); err != nil {
+			return nil, err
+		}
+	}
+	return matrixWithBorder(q.modules, q.border), nil
+}
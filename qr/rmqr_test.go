@@ -0,0 +1,261 @@
+package qr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"qrcode/base"
+	"qrcode/constants"
+	"qrcode/image"
+	"qrcode/utils"
+)
+
+func TestRMQRRoleMap(t *testing.T) {
+	for version := 1; version <= len(utils.RMQRSizes); version++ {
+		for _, level := range []constants.ErrorCorrectionLevel{constants.ERROR_CORRECT_M, constants.ERROR_CORRECT_H} {
+			q, err := NewRMQRCode(version, level, 1, 2, image.PilImage{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := q.AddData("1", 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := q.Make(false); err != nil {
+				t.Fatal(err)
+			}
+			size := q.Size()
+			roles := q.RoleMap()
+			if roles.Width() != size.Width || roles.Height() != size.Height {
+				t.Fatalf("R%dx%d: got a %dx%d role map", size.Height, size.Width, roles.Height(), roles.Width())
+			}
+
+			rsBlocks, err := base.RMQRRSBlocks(version, level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dataCodewords, totalCodewords := 0, 0
+			for _, block := range rsBlocks {
+				dataCodewords += block.DataCount
+				totalCodewords += block.TotalCount
+			}
+			counts := countRoles(roles)
+			if counts[utils.RoleNone] != 0 {
+				t.Errorf("R%dx%d: %d modules without a role", size.Height, size.Width, counts[utils.RoleNone])
+			}
+			// The finder and sub-finder patterns.
+			if counts[utils.RoleFinder] != 49+25 {
+				t.Errorf("R%dx%d: got %d finder modules, want 74", size.Height, size.Width, counts[utils.RoleFinder])
+			}
+			if counts[utils.RoleFormatInfo] != 36 {
+				t.Errorf("R%dx%d: got %d format info modules, want 36", size.Height, size.Width, counts[utils.RoleFormatInfo])
+			}
+			if counts[utils.RoleData] != 8*dataCodewords || counts[utils.RoleErrorCorrection] != 8*(totalCodewords-dataCodewords) {
+				t.Errorf("R%dx%d: got %d data and %d error correction modules, want %d and %d", size.Height, size.Width,
+					counts[utils.RoleData], counts[utils.RoleErrorCorrection], 8*dataCodewords, 8*(totalCodewords-dataCodewords))
+			}
+
+			// Only the finder and the sub-finder are drawn as eyes, not the
+			// corner patterns.
+			im, err := q.MakeImage(image.PilImage{}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h, w := size.Height, size.Width
+			if !im.IsEye(0, 0) || !im.IsEye(6, 6) || !im.IsEye(h-5, w-5) || !im.IsEye(h-1, w-1) {
+				t.Errorf("R%dx%d: a finder module is not drawn as an eye", h, w)
+			}
+			if im.IsEye(0, w-1) || im.IsEye(1, w-1) || h > 7 && im.IsEye(h-1, 0) || im.IsEye(0, 7) {
+				t.Errorf("R%dx%d: a corner pattern is drawn as an eye", h, w)
+			}
+		}
+	}
+}
+
+// TestRMQRKnownAnswers checks a complete symbol of every height, built by an
+// independent encoder from the layout of ISO/IEC 23941. The R15 and R17
+// symbols interleave two blocks of different lengths.
+func TestRMQRKnownAnswers(t *testing.T) {
+	tests := []struct {
+		size            utils.RMQRSize
+		errorCorrection constants.ErrorCorrectionLevel
+		data            string
+		matrix          []string
+	}{
+		{
+			size: utils.RMQRSize{Height: 7, Width: 43}, errorCorrection: constants.ERROR_CORRECT_M, data: "123456",
+			matrix: []string{
+				"#######.#.#.#.#.#.#.###.#.#.#.#.#.#.#.#.###",
+				"#.....#..#.#.....#..#.##....##..##.##...#.#",
+				"#.###.#.#.###...#######.##...##.#.#########",
+				"#.###.#..##...#..#.##.###..#######....#...#",
+				"#.###.#...#.#..####.###...#...###..#..#.#.#",
+				"#.....#.####...###.##.######..#.#####.#...#",
+				"#######.#.#.#.#.#.#.###.#.#.#.#.#.#.#.#####",
+			},
+		},
+		{
+			size: utils.RMQRSize{Height: 9, Width: 43}, errorCorrection: constants.ERROR_CORRECT_H, data: "RMQR",
+			matrix: []string{
+				"#######.#.#.#.#.#.#.###.#.#.#.#.#.#.#.#.###",
+				"#.....#...##.####..##.##..#.#.###..#.#....#",
+				"#.###.#...##..#.########..##.....##..#.##.#",
+				"#.###.#.##.#.#.##..#..###....##....#.#...#.",
+				"#.###.#.#.##..##.#...#.#.#.#.#..##..#######",
+				"#.....#.##..#.##.##...##.......#..##.##...#",
+				"#######..###.#..#...###.....#..###....#.#.#",
+				"........#.#.....###.#.#...####..#######...#",
+				"###.#.#.#.#.#.#.#.#.###.#.#.#.#.#.#.#.#####",
+			},
+		},
+		{
+			size: utils.RMQRSize{Height: 11, Width: 27}, errorCorrection: constants.ERROR_CORRECT_M, data: "ABC",
+			matrix: []string{
+				"#######.#.#.#.#.#.#.#.#.###",
+				"#.....#.###.##...####.#.#.#",
+				"#.###.#..###..#..#..#...###",
+				"#.###.#...#..#.......###...",
+				"#.###.#....####.####..###.#",
+				"#.....#..##..###....###.##.",
+				"#######.#.#.###.#.#..######",
+				"........##..###.###.#.#...#",
+				"#####.#..#.#.###..##.##.#.#",
+				"#.#...##..#..##..#..#.#...#",
+				"###.#.#.#.#.#.#.#.#.#.#####",
+			},
+		},
+		{
+			size: utils.RMQRSize{Height: 13, Width: 27}, errorCorrection: constants.ERROR_CORRECT_H, data: "1",
+			matrix: []string{
+				"#######.#.#.#.#.#.#.#.#.###",
+				"#.....#.#..#.#.#....##....#",
+				"#.###.#.#.#.....##..#.##..#",
+				"#.###.#.#.##..#.....##...#.",
+				"#.###.#.#.###.#..#.##..####",
+				"#.....#.#.##.###.###..####.",
+				"#######..#...#.####..####.#",
+				".........#.#.###..#....#...",
+				"####..#..#....###..########",
+				".#.......#.####.#..##.#...#",
+				"#.##.#..##.#...###....#.#.#",
+				"#..#.##.###.#.###.##..#...#",
+				"###.#.#.#.#.#.#.#.#.#.#####",
+			},
+		},
+		{
+			size: utils.RMQRSize{Height: 15, Width: 43}, errorCorrection: constants.ERROR_CORRECT_H, data: "rMQR bytes",
+			matrix: []string{
+				"#######.#.#.#.#.#.#.###.#.#.#.#.#.#.#.#.###",
+				"#.....#..#.####..##.#.#..#########.##.#...#",
+				"#.###.#.#.#..##...#####...##.##.###...#.#.#",
+				"#.###.#.######.....##.#.##...#.##.#.##.....",
+				"#.###.#.##.......##..###..######....##..#.#",
+				"#.....#..#.#.......##.#..##..##.#..##.##.#.",
+				"#######..###....##########.###......#.#.#.#",
+				"........##.###.....#...###.....#.##..#..##.",
+				"######.##.#.#####..#.##.....#####.#.#######",
+				".#.###.######.....###...#..#....#.###..#...",
+				"###..##...##..#.#.#..##.##....##.##########",
+				".##....##.#.####...##.#..######..#.#..#...#",
+				"##.....#.#....##.##.####...####..#..###.#.#",
+				"#.#.##....######...##.#.......###.#.###...#",
+				"###.#.#.#.#.#.#.#.#.###.#.#.#.#.#.#.#.#####",
+			},
+		},
+		{
+			size: utils.RMQRSize{Height: 17, Width: 43}, errorCorrection: constants.ERROR_CORRECT_H, data: "HELLO WORLD 12345",
+			matrix: []string{
+				"#######.#.#.#.#.#.#.###.#.#.#.#.#.#.#.#.###",
+				"#.....#.##..##...#..#.###.#.#.#.##..###.#.#",
+				"#.###.#..#....#.#.#.#####.###..#####...#.##",
+				"#.###.#..#.##.##..###.#..###.#....###.##.#.",
+				"#.###.#.##...#....##.####.#...##..#...#..##",
+				"#.....#..#########.....####..##..##.##..##.",
+				"#######.###..#.....#.##......#..##...###.##",
+				"........##....#.#...#..#.###...#.....#...#.",
+				"###.##.##.##.#..#.#..##.##.####.#..##..#..#",
+				".#.###...#...##....##....#.#...#######..#..",
+				"#..###.####..####.#####.##.##..##.##.##.#.#",
+				"...#..#.##...#.#....#......#####.##.#.##.#.",
+				"#.#######.##.#...#...###...#....##....#####",
+				"....#.####..#.#..###...#.#.....##.#..##...#",
+				"####.##.##.#######..#####..###.#..#.###.#.#",
+				"#.##.#####.#.###....#.###..#.##.....#.#...#",
+				"###.#.#.#.#.#.#.#.#.###.#.#.#.#.#.#.#.#####",
+			},
+		},
+	}
+	for _, tt := range tests {
+		version, err := utils.RMQRVersion(tt.size.Height, tt.size.Width)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := NewRMQRCode(version, tt.errorCorrection, 1, 0, image.PilImage{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := q.AddData(tt.data, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.Make(false); err != nil {
+			t.Fatalf("%s: %v", tt.size, err)
+		}
+		if got := matrixRows(matrixWithBorder(q.modules, 0)); !reflect.DeepEqual(got, tt.matrix) {
+			t.Errorf("%s-%s %q: got matrix\n%s\nwant\n%s", tt.size, tt.errorCorrection, tt.data, strings.Join(got, "\n"), strings.Join(tt.matrix, "\n"))
+		}
+	}
+}
+
+// TestRMQRFormatInfo checks the BCH(18,6) code of the format information,
+// the code of the QR version information, against ISO/IEC 18004 Table D.1,
+// and the masked bits MakeImpl places next to both finder patterns.
+func TestRMQRFormatInfo(t *testing.T) {
+	want := []int{
+		0x07C94, 0x085BC, 0x09A99, 0x0A4D3, 0x0BBF6, 0x0C762, 0x0D847, 0x0E60D,
+		0x0F928, 0x10B78, 0x1145D, 0x12A17, 0x13532, 0x149A6, 0x15683, 0x168C9,
+		0x177EC, 0x18EC4, 0x191E1, 0x1AFAB, 0x1B08E, 0x1CC1A, 0x1D33F, 0x1ED75,
+		0x1F250, 0x209D5, 0x216F0, 0x228BA, 0x2379F, 0x24B0B, 0x2542E, 0x26A64,
+		0x27541, 0x28C69,
+	}
+	for i, bits := range want {
+		if got := utils.BCHRMQRFormatInfo(i + 7); got != bits {
+			t.Errorf("BCHRMQRFormatInfo(%06b) = %018b, want %018b", i+7, got, bits)
+		}
+	}
+
+	for version := 1; version <= len(utils.RMQRSizes); version++ {
+		for level, errorCorrection := range []constants.ErrorCorrectionLevel{constants.ERROR_CORRECT_M, constants.ERROR_CORRECT_H} {
+			q, err := NewRMQRCode(version, errorCorrection, 1, 0, image.PilImage{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := q.AddData("1", 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := q.Make(false); err != nil {
+				t.Fatal(err)
+			}
+			h, w := q.height, q.width
+			finder, subFinder := 0, 0
+			for i := 0; i < 18; i++ {
+				if q.modules.Get(1+i%5, 8+i/5) {
+					finder |= 1 << i
+				}
+				row, col := h-6+i%5, w-8+i/5
+				if i >= 15 {
+					row, col = h-6, w-5+i-15
+				}
+				if q.modules.Get(row, col) {
+					subFinder |= 1 << i
+				}
+			}
+			bits := utils.BCHRMQRFormatInfo(level<<5 | (version - 1))
+			if bits>>12 != level<<5|(version-1) {
+				t.Errorf("%s-%s: format information %018b does not start with its data", q.Size(), errorCorrection, bits)
+			}
+			if finder != bits^utils.RMQR_FINDER_MASK || subFinder != bits^utils.RMQR_SUB_FINDER_MASK {
+				t.Errorf("%s-%s: got format information %018b and %018b, want %018b masked", q.Size(), errorCorrection, finder, subFinder, bits)
+			}
+		}
+	}
+}
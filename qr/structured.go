@@ -0,0 +1,121 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"qrcode/constants"
+	"qrcode/image"
+	"qrcode/utils"
+	"unicode/utf8"
+)
+
+// NewStructuredAppend splits data across the fewest linked symbols that hold it
+// at the given error correction level. When it takes more than one symbol,
+// every symbol carries a Structured Append header with its position, the
+// symbol count and the parity of the whole data. Each symbol uses the smallest
+// version that fits its own part.
+func NewStructuredAppend(data []byte, errorCorrection constants.ErrorCorrectionLevel, boxSize, border int, imageFactory image.PilImage) ([]*QRCode, error) {
+	if err := CheckErrorCorrection(errorCorrection); err != nil {
+		return nil, err
+	}
+	parity := utils.StructuredAppendParity(data)
+
+	for total := 1; total <= utils.MaxStructuredAppendSymbols; total++ {
+		dataLists, err := splitStructuredAppend(data, total, parity)
+		if err != nil {
+			return nil, err
+		}
+
+		versions := make([]int, total)
+		fits := true
+		for i, dataList := range dataLists {
+			version, err := fitVersion(dataList, errorCorrection, 1)
+			if err != nil {
+				return nil, err
+			}
+			if version == 0 {
+				fits = false
+				break
+			}
+			versions[i] = version
+		}
+		if !fits {
+			continue
+		}
+
+		symbols := make([]*QRCode, total)
+		for i, dataList := range dataLists {
+			q, err := NewQRCode(versions[i], errorCorrection, boxSize, border, imageFactory, MaskAuto)
+			if err != nil {
+				return nil, err
+			}
+			for _, segment := range dataList {
+				if err := q.AddData(segment, 0); err != nil {
+					return nil, err
+				}
+			}
+			symbols[i] = q
+		}
+		return symbols, nil
+	}
+
+	return nil, fmt.Errorf("data does not fit in %d symbols", utils.MaxStructuredAppendSymbols)
+}
+
+// splitStructuredAppend cuts data into total parts of near equal size, each
+// preceded by its Structured Append header. UTF-8 text is cut between
+// characters. A single part is a plain symbol without a header.
+func splitStructuredAppend(data []byte, total, parity int) ([][]utils.QRData, error) {
+	chunkSize := (len(data) + total - 1) / total
+	text := utf8.Valid(data)
+	dataLists := make([][]utils.QRData, total)
+	start := 0
+	for i := 0; i < total; i++ {
+		end := min(start+chunkSize, len(data))
+		if i == total-1 {
+			end = len(data)
+		}
+		if text {
+			cut := end
+			for cut > start && cut < len(data) && !utf8.RuneStart(data[cut]) {
+				cut--
+			}
+			if cut == start {
+				// The part is shorter than the character, so take it whole.
+				for cut = end; cut < len(data) && !utf8.RuneStart(data[cut]); cut++ {
+				}
+			}
+			end = cut
+		}
+		// NewQRData keeps the slice it is given, so copy the chunk out of
+		// the caller's data.
+		chunk := bytes.Clone(data[start:end])
+		start = end
+
+		mode := utils.OptimalMode(chunk)
+		if total == 1 {
+			segment, err := utils.NewQRData(chunk, mode, false)
+			if err != nil {
+				return nil, err
+			}
+			dataLists[i] = []utils.QRData{*segment}
+			continue
+		}
+
+		header, err := utils.NewStructuredAppendData(i, total, parity)
+		if err != nil {
+			return nil, err
+		}
+
+		// The parity covers the data as given, so keep Kanji text in byte mode.
+		if mode == utils.ModeKanji {
+			mode = utils.ModeByte
+		}
+		segment, err := utils.NewQRData(chunk, mode, false)
+		if err != nil {
+			return nil, err
+		}
+		dataLists[i] = []utils.QRData{*header, *segment}
+	}
+	return dataLists, nil
+}
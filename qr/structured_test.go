@@ -0,0 +1,86 @@
+package qr
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"qrcode/constants"
+	"qrcode/image"
+	"qrcode/utils"
+)
+
+func TestSplitStructuredAppend(t *testing.T) {
+	text := []byte(strings.Repeat("aé€😀", 7))
+	parity := utils.StructuredAppendParity(text)
+	for total := 2; total <= 12; total++ {
+		data := bytes.Clone(text)
+		dataLists, err := splitStructuredAppend(data, total, parity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The parts must not alias the caller's data.
+		for i := range data {
+			data[i] = 0
+		}
+
+		var joined []byte
+		for i, dataList := range dataLists {
+			if len(dataList) != 2 || dataList[0].GetMode() != utils.ModeStructuredAppend {
+				t.Fatalf("total %d, part %d: missing Structured Append header", total, i)
+			}
+			part := dataList[1].String()
+			if !utf8.ValidString(part) {
+				t.Errorf("total %d, part %d: %q is cut inside a character", total, i, part)
+			}
+			joined = append(joined, part...)
+		}
+		if !bytes.Equal(joined, text) {
+			t.Errorf("total %d: parts join to %q, want %q", total, joined, text)
+		}
+	}
+
+	// Binary data is cut at byte offsets.
+	binary := []byte{0xFF, 0x80, 0x80, 0x80, 0xFE, 0x80}
+	dataLists, err := splitStructuredAppend(binary, 3, utils.StructuredAppendParity(binary))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, dataList := range dataLists {
+		if got := dataList[1].String(); got != string(binary[2*i:2*i+2]) {
+			t.Errorf("binary part %d: got % X, want % X", i, got, binary[2*i:2*i+2])
+		}
+	}
+}
+
+func TestStructuredAppend(t *testing.T) {
+	symbols, err := NewStructuredAppend([]byte("HELLO WORLD"), constants.ERROR_CORRECT_M, 1, 4, image.PilImage{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(symbols) != 1 || len(symbols[0].DataList) != 1 || symbols[0].DataList[0].GetMode() == utils.ModeStructuredAppend {
+		t.Errorf("a single symbol carries a Structured Append header")
+	}
+
+	data := []byte(strings.Repeat("Structured Append ü ", 200))
+	if symbols, err = NewStructuredAppend(data, constants.ERROR_CORRECT_H, 1, 4, image.PilImage{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(symbols) < 2 {
+		t.Fatalf("got %d symbols, want at least 2", len(symbols))
+	}
+	var joined []byte
+	for i, q := range symbols {
+		if len(q.DataList) != 2 || q.DataList[0].GetMode() != utils.ModeStructuredAppend {
+			t.Fatalf("symbol %d: missing Structured Append header", i)
+		}
+		joined = append(joined, q.DataList[1].String()...)
+		if _, err := q.GetMatrix(); err != nil {
+			t.Errorf("symbol %d: %v", i, err)
+		}
+	}
+	if !bytes.Equal(joined, data) {
+		t.Error("the symbols do not join to the data")
+	}
+}
@@ -0,0 +1,156 @@
+package qr
+
+import (
+	"encoding/json"
+	"qrcode/base"
+	"qrcode/constants"
+	"qrcode/utils"
+)
+
+// Trace describes how a symbol was encoded, from the data segments down to
+// the codeword order and the mask selection.
+type Trace struct {
+	Version         int                            `json:"version"`
+	ErrorCorrection constants.ErrorCorrectionLevel `json:"error_correction"`
+	MaskPattern     int                            `json:"mask_pattern"`
+	Segments        []SegmentTrace                 `json:"segments"`
+	SegmentBits     int                            `json:"segment_bits"`
+	TerminatorBits  int                            `json:"terminator_bits"`
+	PaddingBits     int                            `json:"padding_bits"`
+	PadCodewords    int                            `json:"pad_codewords"`
+	CapacityBits    int                            `json:"capacity_bits"`
+	Blocks          []BlockTrace                   `json:"blocks"`
+	Interleaved     []CodewordTrace                `json:"interleaved"`
+	MaskScores      []MaskScoreTrace               `json:"mask_scores,omitempty"`
+}
+
+// SegmentTrace describes one data segment. HeaderBits counts the mode
+// indicator and the character count indicator.
+type SegmentTrace struct {
+	Mode       string `json:"mode"`
+	Characters int    `json:"characters"`
+	HeaderBits int    `json:"header_bits"`
+	Bits       int    `json:"bits"`
+}
+
+// BlockTrace holds the codewords of one Reed-Solomon block.
+type BlockTrace struct {
+	DataCodewords            []int `json:"data_codewords"`
+	ErrorCorrectionCodewords []int `json:"error_correction_codewords"`
+}
+
+// CodewordTrace locates a codeword of the interleaved sequence in its block.
+type CodewordTrace struct {
+	Block           int  `json:"block"`
+	Index           int  `json:"index"`
+	ErrorCorrection bool `json:"error_correction"`
+	Value           int  `json:"value"`
+}
+
+// MaskScoreTrace holds the penalty scores of one mask pattern.
+type MaskScoreTrace struct {
+	MaskPattern int                `json:"mask_pattern"`
+	Score       utils.PenaltyScore `json:"score"`
+	Total       int                `json:"total"`
+}
+
+// JSON returns the trace as indented JSON.
+func (t *Trace) JSON() ([]byte, error) {
+	return json.MarshalIndent(t, "", "  ")
+}
+
+// Trace builds the symbol if needed and describes how it was encoded. Mask
+// scores are only present when the mask was selected automatically.
+func (q *QRCode) Trace() (*Trace, error) {
+	if q.dataCache == nil {
+		if err := q.Make(true); err != nil {
+			return nil, err
+		}
+	}
+
+	rsBlocks, err := base.RSBlocks(q.version, q.usedErrorCorrection)
+	if err != nil {
+		return nil, err
+	}
+
+	trace := &Trace{
+		Version:         q.version,
+		ErrorCorrection: q.usedErrorCorrection,
+		MaskPattern:     q.usedMaskPattern,
+		CapacityBits:    BIT_LIMIT_TABLE[q.usedErrorCorrection][q.version],
+	}
+
+	for i := range q.DataList {
+		data := &q.DataList[i]
+		buffer := utils.NewBitBuffer()
+		if err := data.WriteSegment(buffer, q.version); err != nil {
+			return nil, err
+		}
+
+		segment := SegmentTrace{
+			Mode:       utils.ModeName(data.GetMode()),
+			HeaderBits: 4,
+			Bits:       buffer.Len(),
+		}
+		switch data.GetMode() {
+		case utils.ModeNumeric, utils.ModeAlphanumeric, utils.ModeByte, utils.ModeKanji:
+			segment.Characters = data.Len()
+			length, err := utils.LengthInBits(data.GetMode(), q.version)
+			if err != nil {
+				return nil, err
+			}
+			segment.HeaderBits += length
+		}
+		trace.Segments = append(trace.Segments, segment)
+		trace.SegmentBits += segment.Bits
+	}
+
+	// Mirror the terminator and padding rules of utils.CreateData.
+	trace.TerminatorBits = min(trace.CapacityBits-trace.SegmentBits, 4)
+	length := trace.SegmentBits + trace.TerminatorBits
+	if length%8 != 0 {
+		trace.PaddingBits = 8 - length%8
+	}
+	length += trace.PaddingBits
+	trace.PadCodewords = (trace.CapacityBits - length) / 8
+
+	// Split the interleaved codewords back into their blocks.
+	trace.Blocks = make([]BlockTrace, len(rsBlocks))
+	maxDcCount, maxEcCount := 0, 0
+	for i, block := range rsBlocks {
+		trace.Blocks[i].DataCodewords = make([]int, 0, block.DataCount)
+		trace.Blocks[i].ErrorCorrectionCodewords = make([]int, 0, block.TotalCount-block.DataCount)
+		maxDcCount = max(maxDcCount, block.DataCount)
+		maxEcCount = max(maxEcCount, block.TotalCount-block.DataCount)
+	}
+	index := 0
+	for i := 0; i < maxDcCount; i++ {
+		for r, block := range rsBlocks {
+			if i < block.DataCount {
+				trace.Blocks[r].DataCodewords = append(trace.Blocks[r].DataCodewords, q.dataCache[index])
+				trace.Interleaved = append(trace.Interleaved, CodewordTrace{Block: r, Index: i, Value: q.dataCache[index]})
+				index++
+			}
+		}
+	}
+	for i := 0; i < maxEcCount; i++ {
+		for r, block := range rsBlocks {
+			if i < block.TotalCount-block.DataCount {
+				trace.Blocks[r].ErrorCorrectionCodewords = append(trace.Blocks[r].ErrorCorrectionCodewords, q.dataCache[index])
+				trace.Interleaved = append(trace.Interleaved, CodewordTrace{Block: r, Index: i, ErrorCorrection: true, Value: q.dataCache[index]})
+				index++
+			}
+		}
+	}
+
+	if q.maskPattern == MaskAuto {
+		for pattern, score := range q.maskScores {
+			trace.MaskScores = append(trace.MaskScores, MaskScoreTrace{
+				MaskPattern: pattern,
+				Score:       score,
+				Total:       score.Total(),
+			})
+		}
+	}
+	return trace, nil
+}
@@ -0,0 +1,55 @@
+package signing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Sentinel errors for errors.Is. The typed errors below match them.
+var (
+	ErrTampered   = errors.New("tampered payload")
+	ErrExpired    = errors.New("expired payload")
+	ErrUnknownKey = errors.New("unknown key")
+)
+
+// TamperedError reports a token that is malformed or whose signature does
+// not match its contents.
+type TamperedError struct {
+	Reason string
+}
+
+func (e *TamperedError) Error() string {
+	return fmt.Sprintf("tampered payload: %s", e.Reason)
+}
+
+func (e *TamperedError) Is(target error) bool {
+	return target == ErrTampered
+}
+
+// ExpiredError reports a token with a valid signature whose expiry has passed.
+type ExpiredError struct {
+	ExpiresAt time.Time
+	Now       time.Time
+}
+
+func (e *ExpiredError) Error() string {
+	return fmt.Sprintf("expired payload: expired at %s, now %s", e.ExpiresAt.UTC().Format(time.RFC3339), e.Now.UTC().Format(time.RFC3339))
+}
+
+func (e *ExpiredError) Is(target error) bool {
+	return target == ErrExpired
+}
+
+// UnknownKeyError reports a token signed with a key the verifier does not hold.
+type UnknownKeyError struct {
+	KeyID string
+}
+
+func (e *UnknownKeyError) Error() string {
+	return fmt.Sprintf("unknown key (%q)", e.KeyID)
+}
+
+func (e *UnknownKeyError) Is(target error) bool {
+	return target == ErrUnknownKey
+}
@@ -0,0 +1,273 @@
+// Package signing wraps QR payloads in signed tokens that can be verified
+// offline. A token holds the payload, the ID of the signing key and an
+// optional expiry, followed by an Ed25519 or HMAC-SHA256 signature:
+//
+//	version (1 byte) | algorithm (1 byte) | key ID length (1 byte) | key ID |
+//	expiry in Unix seconds (uvarint, 0 for none) |
+//	payload length (uvarint) | payload | signature
+//
+// The signature covers every byte before it. Add a token from Sign to a
+// symbol with QRCode.AddData(qr.Base45(token)), which stores it Base45
+// encoded in an alphanumeric segment, or as is with AddData(token) in byte
+// mode. SignText returns the Base45 text itself, for tokens carried after a
+// prefix or outside a QR code.
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"qrcode/utils"
+	"time"
+)
+
+// tokenVersion is the version of the token layout.
+const tokenVersion = 1
+
+// Algorithm identifies the signature algorithm of a token.
+type Algorithm byte
+
+const (
+	Ed25519    Algorithm = 1
+	HMACSHA256 Algorithm = 2
+)
+
+// MinHMACKeySize is the smallest HMAC key NewHMACSigner and AddHMACKey accept.
+const MinHMACKeySize = sha256.Size
+
+// MaxKeyIDLength is the longest key ID a token can carry.
+const MaxKeyIDLength = 255
+
+func (a Algorithm) String() string {
+	switch a {
+	case Ed25519:
+		return "Ed25519"
+	case HMACSHA256:
+		return "HMAC-SHA256"
+	}
+	return fmt.Sprintf("Algorithm(%d)", byte(a))
+}
+
+func (a Algorithm) signatureSize() int {
+	switch a {
+	case Ed25519:
+		return ed25519.SignatureSize
+	case HMACSHA256:
+		return sha256.Size
+	}
+	return 0
+}
+
+// Claims is the content of a token.
+type Claims struct {
+	KeyID     string
+	Algorithm Algorithm
+	Payload   []byte
+	// ExpiresAt is the zero time for tokens that do not expire.
+	ExpiresAt time.Time
+}
+
+// Signer creates tokens with one key.
+type Signer struct {
+	keyID      string
+	algorithm  Algorithm
+	privateKey ed25519.PrivateKey
+	hmacKey    []byte
+}
+
+func checkKeyID(keyID string) error {
+	if len(keyID) > MaxKeyIDLength {
+		return fmt.Errorf("key ID too long (%d bytes)", len(keyID))
+	}
+	return nil
+}
+
+// NewEd25519Signer creates a Signer that signs with an Ed25519 private key.
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) (*Signer, error) {
+	if err := checkKeyID(keyID); err != nil {
+		return nil, err
+	}
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 private key size (%d)", len(key))
+	}
+	return &Signer{keyID: keyID, algorithm: Ed25519, privateKey: key}, nil
+}
+
+// NewHMACSigner creates a Signer that signs with HMAC-SHA256. The key must
+// be at least MinHMACKeySize bytes long.
+func NewHMACSigner(keyID string, key []byte) (*Signer, error) {
+	if err := checkKeyID(keyID); err != nil {
+		return nil, err
+	}
+	if len(key) < MinHMACKeySize {
+		return nil, fmt.Errorf("HMAC key too short (%d bytes, want at least %d)", len(key), MinHMACKeySize)
+	}
+	return &Signer{keyID: keyID, algorithm: HMACSHA256, hmacKey: append([]byte(nil), key...)}, nil
+}
+
+// Sign returns a token holding payload. A zero expiresAt makes a token that
+// does not expire; otherwise it is stored with a precision of one second.
+func (s *Signer) Sign(payload []byte, expiresAt time.Time) ([]byte, error) {
+	var expiry uint64
+	if !expiresAt.IsZero() {
+		if expiresAt.Unix() < 1 {
+			return nil, fmt.Errorf("invalid expiry (%s)", expiresAt)
+		}
+		expiry = uint64(expiresAt.Unix())
+	}
+
+	token := []byte{tokenVersion, byte(s.algorithm), byte(len(s.keyID))}
+	token = append(token, s.keyID...)
+	token = binary.AppendUvarint(token, expiry)
+	token = binary.AppendUvarint(token, uint64(len(payload)))
+	token = append(token, payload...)
+
+	switch s.algorithm {
+	case Ed25519:
+		token = append(token, ed25519.Sign(s.privateKey, token)...)
+	case HMACSHA256:
+		token = append(token, hmacSum(s.hmacKey, token)...)
+	}
+	return token, nil
+}
+
+// SignText returns a token as Base45 text, which fits an alphanumeric segment.
+func (s *Signer) SignText(payload []byte, expiresAt time.Time) (string, error) {
+	token, err := s.Sign(payload, expiresAt)
+	if err != nil {
+		return "", err
+	}
+	return utils.Base45Encode(token), nil
+}
+
+func hmacSum(key, message []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+type verifyKey struct {
+	algorithm Algorithm
+	publicKey ed25519.PublicKey
+	hmacKey   []byte
+}
+
+// Verifier checks tokens against the keys it holds, without network access.
+type Verifier struct {
+	keys map[string]verifyKey
+	// Now returns the time expiries are checked against. It defaults to
+	// time.Now.
+	Now func() time.Time
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{keys: make(map[string]verifyKey)}
+}
+
+// AddEd25519Key adds the public key of an Ed25519 signer.
+func (v *Verifier) AddEd25519Key(keyID string, key ed25519.PublicKey) error {
+	if err := checkKeyID(keyID); err != nil {
+		return err
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid Ed25519 public key size (%d)", len(key))
+	}
+	v.keys[keyID] = verifyKey{algorithm: Ed25519, publicKey: key}
+	return nil
+}
+
+// AddHMACKey adds the shared key of an HMAC-SHA256 signer.
+func (v *Verifier) AddHMACKey(keyID string, key []byte) error {
+	if err := checkKeyID(keyID); err != nil {
+		return err
+	}
+	if len(key) < MinHMACKeySize {
+		return fmt.Errorf("HMAC key too short (%d bytes, want at least %d)", len(key), MinHMACKeySize)
+	}
+	v.keys[keyID] = verifyKey{algorithm: HMACSHA256, hmacKey: append([]byte(nil), key...)}
+	return nil
+}
+
+// Verify checks the signature and expiry of token and returns its claims.
+// It returns a *TamperedError for malformed tokens and bad signatures, an
+// *UnknownKeyError for keys it does not hold and an *ExpiredError for
+// expired tokens. The expiry is only checked once the signature is valid.
+func (v *Verifier) Verify(token []byte) (*Claims, error) {
+	if len(token) < 3 {
+		return nil, &TamperedError{Reason: "truncated header"}
+	}
+	header, r := token[:3], bytes.NewReader(token[3:])
+	if header[0] != tokenVersion {
+		return nil, &TamperedError{Reason: fmt.Sprintf("unknown token version %d", header[0])}
+	}
+	claims := &Claims{Algorithm: Algorithm(header[1])}
+	if claims.Algorithm.signatureSize() == 0 {
+		return nil, &TamperedError{Reason: fmt.Sprintf("unknown algorithm %d", header[1])}
+	}
+
+	keyID := make([]byte, header[2])
+	if n, _ := r.Read(keyID); n != len(keyID) {
+		return nil, &TamperedError{Reason: "truncated key ID"}
+	}
+	claims.KeyID = string(keyID)
+
+	expiry, err := binary.ReadUvarint(r)
+	if err != nil || expiry > 1<<62 {
+		return nil, &TamperedError{Reason: "invalid expiry"}
+	}
+	if expiry != 0 {
+		claims.ExpiresAt = time.Unix(int64(expiry), 0)
+	}
+	length, err := binary.ReadUvarint(r)
+	if err != nil || length > uint64(r.Len()) {
+		return nil, &TamperedError{Reason: "invalid payload length"}
+	}
+	claims.Payload = make([]byte, length)
+	r.Read(claims.Payload)
+
+	signed := token[:len(token)-r.Len()]
+	signature := token[len(signed):]
+	if len(signature) != claims.Algorithm.signatureSize() {
+		return nil, &TamperedError{Reason: fmt.Sprintf("signature is %d bytes, want %d", len(signature), claims.Algorithm.signatureSize())}
+	}
+
+	key, ok := v.keys[claims.KeyID]
+	if !ok {
+		return nil, &UnknownKeyError{KeyID: claims.KeyID}
+	}
+	if key.algorithm != claims.Algorithm {
+		return nil, &TamperedError{Reason: fmt.Sprintf("key %q is not an %s key", claims.KeyID, claims.Algorithm)}
+	}
+	switch key.algorithm {
+	case Ed25519:
+		ok = ed25519.Verify(key.publicKey, signed, signature)
+	case HMACSHA256:
+		ok = hmac.Equal(hmacSum(key.hmacKey, signed), signature)
+	}
+	if !ok {
+		return nil, &TamperedError{Reason: "signature mismatch"}
+	}
+
+	if !claims.ExpiresAt.IsZero() {
+		now := time.Now()
+		if v.Now != nil {
+			now = v.Now()
+		}
+		if !now.Before(claims.ExpiresAt) {
+			return nil, &ExpiredError{ExpiresAt: claims.ExpiresAt, Now: now}
+		}
+	}
+	return claims, nil
+}
+
+// VerifyText verifies a token created by SignText.
+func (v *Verifier) VerifyText(text string) (*Claims, error) {
+	token, err := utils.Base45Decode(text)
+	if err != nil {
+		return nil, &TamperedError{Reason: err.Error()}
+	}
+	return v.Verify(token)
+}
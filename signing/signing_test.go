@@ -0,0 +1,201 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	testNow     = time.Unix(1_700_000_000, 0)
+	testPayload = []byte("HC1:offline verifiable payload")
+)
+
+type testKey struct {
+	name   string
+	signer func(keyID string) (*Signer, error)
+	add    func(v *Verifier, keyID string) error
+}
+
+func testKeys(t *testing.T) []testKey {
+	t.Helper()
+	privateKey := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+	hmacKey := bytes.Repeat([]byte{9}, MinHMACKeySize)
+	return []testKey{
+		{
+			name:   "Ed25519",
+			signer: func(keyID string) (*Signer, error) { return NewEd25519Signer(keyID, privateKey) },
+			add: func(v *Verifier, keyID string) error {
+				return v.AddEd25519Key(keyID, privateKey.Public().(ed25519.PublicKey))
+			},
+		},
+		{
+			name:   "HMAC-SHA256",
+			signer: func(keyID string) (*Signer, error) { return NewHMACSigner(keyID, hmacKey) },
+			add:    func(v *Verifier, keyID string) error { return v.AddHMACKey(keyID, hmacKey) },
+		},
+	}
+}
+
+// setup returns a signer for key ID "k1" and a verifier that holds its key
+// and checks expiries against testNow.
+func setup(t *testing.T, key testKey) (*Signer, *Verifier) {
+	t.Helper()
+	signer, err := key.signer("k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := NewVerifier()
+	if err := key.add(verifier, "k1"); err != nil {
+		t.Fatal(err)
+	}
+	verifier.Now = func() time.Time { return testNow }
+	return signer, verifier
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, key := range testKeys(t) {
+		t.Run(key.name, func(t *testing.T) {
+			signer, verifier := setup(t, key)
+			for _, expiresAt := range []time.Time{{}, testNow.Add(time.Hour)} {
+				token, err := signer.Sign(testPayload, expiresAt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				claims, err := verifier.Verify(token)
+				if err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				if claims.KeyID != "k1" || claims.Algorithm.String() != key.name {
+					t.Errorf("got key %q and algorithm %s", claims.KeyID, claims.Algorithm)
+				}
+				if !bytes.Equal(claims.Payload, testPayload) {
+					t.Errorf("got payload %q, want %q", claims.Payload, testPayload)
+				}
+				if !claims.ExpiresAt.Equal(expiresAt) {
+					t.Errorf("got expiry %v, want %v", claims.ExpiresAt, expiresAt)
+				}
+
+				text, err := signer.SignText(testPayload, expiresAt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if claims, err = verifier.VerifyText(text); err != nil {
+					t.Fatalf("VerifyText: %v", err)
+				}
+				if !bytes.Equal(claims.Payload, testPayload) {
+					t.Errorf("got text payload %q, want %q", claims.Payload, testPayload)
+				}
+			}
+		})
+	}
+}
+
+func TestTampered(t *testing.T) {
+	for _, key := range testKeys(t) {
+		t.Run(key.name, func(t *testing.T) {
+			signer, verifier := setup(t, key)
+			token, err := signer.Sign(testPayload, testNow.Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Flipping any single bit, from the header to the signature, must
+			// be rejected. A flipped key ID names a key the verifier lacks.
+			for i := range token {
+				tampered := append([]byte(nil), token...)
+				tampered[i] ^= 0x01
+				if _, err := verifier.Verify(tampered); !errors.Is(err, ErrTampered) && !errors.Is(err, ErrUnknownKey) {
+					t.Errorf("byte %d flipped: got %v, want ErrTampered", i, err)
+				}
+			}
+			payloadStart := bytes.Index(token, testPayload)
+			tampered := append([]byte(nil), token...)
+			tampered[payloadStart] ^= 0x01
+			if _, err := verifier.Verify(tampered); !errors.Is(err, ErrTampered) {
+				t.Errorf("payload changed: got %v, want ErrTampered", err)
+			}
+
+			for _, n := range []int{0, 2, payloadStart, len(token) - 1} {
+				if _, err := verifier.Verify(token[:n]); !errors.Is(err, ErrTampered) {
+					t.Errorf("truncated to %d bytes: got %v, want ErrTampered", n, err)
+				}
+			}
+			if _, err := verifier.Verify(append(token, 0)); !errors.Is(err, ErrTampered) {
+				t.Errorf("extended: got %v, want ErrTampered", err)
+			}
+			if _, err := verifier.VerifyText("not base45!"); !errors.Is(err, ErrTampered) {
+				t.Errorf("invalid text: got %v, want ErrTampered", err)
+			}
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	for _, key := range testKeys(t) {
+		t.Run(key.name, func(t *testing.T) {
+			signer, verifier := setup(t, key)
+			expiresAt := testNow.Add(-time.Second)
+			token, err := signer.Sign(testPayload, expiresAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = verifier.Verify(token)
+			if !errors.Is(err, ErrExpired) {
+				t.Fatalf("got %v, want ErrExpired", err)
+			}
+			var expired *ExpiredError
+			if !errors.As(err, &expired) || !expired.ExpiresAt.Equal(expiresAt) || !expired.Now.Equal(testNow) {
+				t.Errorf("got %#v", err)
+			}
+
+			// A token is expired from its expiry second on.
+			if token, err = signer.Sign(testPayload, testNow); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := verifier.Verify(token); !errors.Is(err, ErrExpired) {
+				t.Errorf("expiring now: got %v, want ErrExpired", err)
+			}
+		})
+	}
+}
+
+func TestUnknownKey(t *testing.T) {
+	keys := testKeys(t)
+	for i, key := range keys {
+		t.Run(key.name, func(t *testing.T) {
+			signer, _ := setup(t, key)
+			token, err := signer.Sign(testPayload, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = NewVerifier().Verify(token)
+			var unknown *UnknownKeyError
+			if !errors.Is(err, ErrUnknownKey) || !errors.As(err, &unknown) || unknown.KeyID != "k1" {
+				t.Errorf("empty verifier: got %v, want ErrUnknownKey for k1", err)
+			}
+
+			// Another key under a different ID is unknown too.
+			verifier := NewVerifier()
+			if err := key.add(verifier, "k2"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := verifier.Verify(token); !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("other key ID: got %v, want ErrUnknownKey", err)
+			}
+
+			// The same ID holding a key of the other algorithm must not verify.
+			other := keys[1-i]
+			verifier = NewVerifier()
+			if err := other.add(verifier, "k1"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := verifier.Verify(token); !errors.Is(err, ErrTampered) {
+				t.Errorf("other algorithm: got %v, want ErrTampered", err)
+			}
+		})
+	}
+}
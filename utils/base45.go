@@ -0,0 +1,65 @@
+package utils
+
+import "fmt"
+
+// Base45Encode encodes src as Base45 (RFC 9285). Every two bytes become
+// three characters and a trailing byte becomes two. Base45 uses the
+// alphanumeric character set in the same order, so the result always fits an
+// alphanumeric segment.
+func Base45Encode(src []byte) string {
+	dst := make([]byte, 0, Base45EncodedLen(len(src)))
+	for i := 0; i+1 < len(src); i += 2 {
+		n := int(src[i])<<8 | int(src[i+1])
+		dst = append(dst, AlphanumericChars[n%45], AlphanumericChars[n/45%45], AlphanumericChars[n/(45*45)])
+	}
+	if len(src)%2 == 1 {
+		n := int(src[len(src)-1])
+		dst = append(dst, AlphanumericChars[n%45], AlphanumericChars[n/45])
+	}
+	return string(dst)
+}
+
+// Base45EncodedLen returns the length of the Base45 encoding of n bytes.
+func Base45EncodedLen(n int) int {
+	return n/2*3 + n%2*2
+}
+
+// Base45Decode decodes Base45 text. It rejects characters outside the
+// alphanumeric set, a length that leaves a single character, and groups
+// that do not encode a byte pair or a byte.
+func Base45Decode(s string) ([]byte, error) {
+	if len(s)%3 == 1 {
+		return nil, fmt.Errorf("invalid base45 length (%d)", len(s))
+	}
+
+	dst := make([]byte, 0, len(s)/3*2+len(s)%3/2)
+	for i := 0; i < len(s); i += 3 {
+		end := min(i+3, len(s))
+		n, weight := 0, 1
+		for j := i; j < end; j++ {
+			c := alphanumericIndex(s[j])
+			if c < 0 {
+				return nil, fmt.Errorf("invalid base45 character %q at %d", s[j], j)
+			}
+			n += c * weight
+			weight *= 45
+		}
+		if end-i == 3 {
+			if n > 0xffff {
+				return nil, fmt.Errorf("invalid base45 group %q at %d", s[i:end], i)
+			}
+			dst = append(dst, byte(n>>8), byte(n))
+		} else {
+			if n > 0xff {
+				return nil, fmt.Errorf("invalid base45 group %q at %d", s[i:end], i)
+			}
+			dst = append(dst, byte(n))
+		}
+	}
+	return dst, nil
+}
+
+// NewBase45Data creates an alphanumeric segment holding data encoded as Base45.
+func NewBase45Data(data []byte) (*QRData, error) {
+	return NewSegment([]byte(Base45Encode(data)), ModeAlphanumeric)
+}
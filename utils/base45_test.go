@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// base45Vectors are the examples of RFC 9285 section 4.3 and 4.4.
+var base45Vectors = []struct {
+	decoded, encoded string
+}{
+	{"AB", "BB8"},
+	{"Hello!!", "%69 VD92EX0"},
+	{"base-45", "UJCLQE7W581"},
+	{"ietf!", "QED8WEX0"},
+	{"", ""},
+	{"\x00", "00"},
+	{"\xff\xff", "FGW"},
+}
+
+func TestBase45Vectors(t *testing.T) {
+	for _, tt := range base45Vectors {
+		if got := Base45Encode([]byte(tt.decoded)); got != tt.encoded {
+			t.Errorf("Base45Encode(%q) = %q, want %q", tt.decoded, got, tt.encoded)
+		}
+		if got := Base45EncodedLen(len(tt.decoded)); got != len(tt.encoded) {
+			t.Errorf("Base45EncodedLen(%d) = %d, want %d", len(tt.decoded), got, len(tt.encoded))
+		}
+		got, err := Base45Decode(tt.encoded)
+		if err != nil {
+			t.Errorf("Base45Decode(%q): %v", tt.encoded, err)
+		} else if string(got) != tt.decoded {
+			t.Errorf("Base45Decode(%q) = %q, want %q", tt.encoded, got, tt.decoded)
+		}
+	}
+}
+
+func TestBase45RoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(45))
+	for n := 0; n < 200; n++ {
+		data := make([]byte, n)
+		r.Read(data)
+		encoded := Base45Encode(data)
+		if !ReAlphaNumeric.MatchString(encoded) {
+			t.Fatalf("Base45Encode(%x) = %q is not alphanumeric", data, encoded)
+		}
+		decoded, err := Base45Decode(encoded)
+		if err != nil {
+			t.Fatalf("Base45Decode(%q): %v", encoded, err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Fatalf("round trip of %x gave %x", data, decoded)
+		}
+	}
+}
+
+func TestBase45DecodeInvalid(t *testing.T) {
+	for _, s := range []string{
+		"A",      // A single trailing character.
+		"BB8A",   // Likewise after a full group.
+		"GGW",    // 65536 does not fit two bytes.
+		"::",     // 2024 does not fit a byte.
+		"bb8",    // Lowercase is outside the character set.
+		"BB8\n0", // So is a newline.
+	} {
+		if got, err := Base45Decode(s); err == nil {
+			t.Errorf("Base45Decode(%q) = %q, want an error", s, got)
+		}
+	}
+}
+
+func TestNewBase45Data(t *testing.T) {
+	data, err := NewBase45Data([]byte("Hello!!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.GetMode() != ModeAlphanumeric || data.String() != "%69 VD92EX0" {
+		t.Errorf("got mode %d %q, want an alphanumeric %q", data.GetMode(), data, "%69 VD92EX0")
+	}
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// Deflate compresses data with zlib at the best compression level.
+func Deflate(data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	w, err := zlib.NewWriterLevel(&compressed, zlib.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// Inflate reverses Deflate. It fails once the output exceeds limit bytes, so
+// crafted input cannot expand into an arbitrarily large buffer.
+func Inflate(compressed []byte, limit int) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("decompressed data exceeds %d bytes", limit)
+	}
+	return data, nil
+}
@@ -0,0 +1,48 @@
+package utils
+
+import "fmt"
+
+// ECI assignment numbers for common character sets.
+const (
+	ECIISO8859_1  = 3
+	ECIISO8859_2  = 4
+	ECIISO8859_5  = 7
+	ECIISO8859_7  = 9
+	ECIISO8859_15 = 17
+	ECIShiftJIS   = 20
+	ECIUTF8       = 26
+)
+
+// MaxECIAssignment is the largest assignment number an ECI designator can hold.
+const MaxECIAssignment = 999999
+
+// NewECIData creates an ECI segment that declares the character set of the
+// segments that follow it.
+func NewECIData(assignment int) (*QRData, error) {
+	if assignment < 0 || assignment > MaxECIAssignment {
+		return nil, fmt.Errorf("invalid ECI assignment number (%d)", assignment)
+	}
+	return &QRData{
+		mode: ModeECI,
+		eci:  assignment,
+	}, nil
+}
+
+// ECI returns the assignment number of an ECI segment.
+func (q *QRData) ECI() int {
+	return q.eci
+}
+
+// writeECI writes the ECI designator using one, two or three codewords.
+func (q *QRData) writeECI(buffer *BitBuffer) {
+	switch {
+	case q.eci < 1<<7:
+		buffer.Put(q.eci, 8)
+	case q.eci < 1<<14:
+		buffer.Put(0b10, 2)
+		buffer.Put(q.eci, 14)
+	default:
+		buffer.Put(0b110, 3)
+		buffer.Put(q.eci, 21)
+	}
+}
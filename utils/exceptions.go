@@ -1,11 +1,79 @@
 package utils
 
+import (
+	"errors"
+	"fmt"
+	"qrcode/constants"
+)
+
+// Sentinel errors for errors.Is. The typed errors below match them, so
+// callers can test for the kind of failure without inspecting its fields.
+var (
+	ErrDataOverflow           = errors.New("data overflow")
+	ErrInvalidVersion         = errors.New("invalid version")
+	ErrInvalidMaskPattern     = errors.New("invalid mask pattern")
+	ErrInvalidErrorCorrection = constants.ErrInvalidErrorCorrection
+)
+
 // DataOverflowError represents an error when data exceeds the allowed limit.
 type DataOverflowError struct {
-	message string
+	// Required is the number of data bits the segments need.
+	Required int
+	// Available is the number of data bits the largest allowed symbol holds.
+	Available int
+}
+
+// NewDataOverflowError creates a new DataOverflowError for the required and available bit counts.
+func NewDataOverflowError(required, available int) *DataOverflowError {
+	return &DataOverflowError{Required: required, Available: available}
 }
 
-// NewDataOverflowError creates a new DataOverflowError with the given message.
-func NewDataOverflowError(message string) *DataOverflowError {
-	return &DataOverflowError{message: message}
-}
\ No newline at end of file
+func (e *DataOverflowError) Error() string {
+	return fmt.Sprintf("data overflow: %d bits required, %d bits available", e.Required, e.Available)
+}
+
+func (e *DataOverflowError) Is(target error) bool {
+	return target == ErrDataOverflow
+}
+
+// InvalidVersionError reports a version outside the range of the symbol type.
+type InvalidVersionError struct {
+	Version int
+}
+
+func (e *InvalidVersionError) Error() string {
+	return fmt.Sprintf("invalid version (%d)", e.Version)
+}
+
+func (e *InvalidVersionError) Is(target error) bool {
+	return target == ErrInvalidVersion
+}
+
+// InvalidMaskPatternError reports a mask pattern the symbol type does not have.
+type InvalidMaskPatternError struct {
+	MaskPattern int
+}
+
+func (e *InvalidMaskPatternError) Error() string {
+	return fmt.Sprintf("invalid mask pattern (%d)", e.MaskPattern)
+}
+
+func (e *InvalidMaskPatternError) Is(target error) bool {
+	return target == ErrInvalidMaskPattern
+}
+
+// InvalidErrorCorrectionError reports an unknown or unsupported error correction level.
+type InvalidErrorCorrectionError struct {
+	Level constants.ErrorCorrectionLevel
+}
+
+func (e *InvalidErrorCorrectionError) Error() string {
+	if e.Level.Valid() {
+		return fmt.Sprintf("invalid error correction level (%s)", e.Level)
+	}
+	return fmt.Sprintf("invalid error correction level (%d)", int(e.Level))
+}
+
+func (e *InvalidErrorCorrectionError) Is(target error) bool {
+	return target == ErrInvalidErrorCorrection
+}
@@ -0,0 +1,257 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// GS is the group separator that terminates variable length GS1 element strings.
+const GS = 0x1D
+
+// gs1CharacterSet lists the characters allowed in alphanumeric GS1 values.
+const gs1CharacterSet = "!\"%&'()*+,-./0123456789:;<=>?ABCDEFGHIJKLMNOPQRSTUVWXYZ_abcdefghijklmnopqrstuvwxyz"
+
+// gs1ApplicationIdentifier describes the value format of a GS1 Application Identifier.
+type gs1ApplicationIdentifier struct {
+	minLength  int
+	maxLength  int
+	numeric    bool
+	checkDigit bool
+	date       bool
+}
+
+var (
+	gs1SSCC   = gs1ApplicationIdentifier{minLength: 18, maxLength: 18, numeric: true, checkDigit: true}
+	gs1GTIN   = gs1ApplicationIdentifier{minLength: 14, maxLength: 14, numeric: true, checkDigit: true}
+	gs1GLN    = gs1ApplicationIdentifier{minLength: 13, maxLength: 13, numeric: true, checkDigit: true}
+	gs1Date   = gs1ApplicationIdentifier{minLength: 6, maxLength: 6, numeric: true, date: true}
+	gs1Amount = gs1ApplicationIdentifier{minLength: 6, maxLength: 6, numeric: true}
+)
+
+// gs1ApplicationIdentifiers lists the supported Application Identifiers.
+var gs1ApplicationIdentifiers = map[string]gs1ApplicationIdentifier{
+	"00":   gs1SSCC,
+	"01":   gs1GTIN,
+	"02":   gs1GTIN,
+	"10":   {minLength: 1, maxLength: 20},
+	"11":   gs1Date,
+	"12":   gs1Date,
+	"13":   gs1Date,
+	"15":   gs1Date,
+	"16":   gs1Date,
+	"17":   gs1Date,
+	"20":   {minLength: 2, maxLength: 2, numeric: true},
+	"21":   {minLength: 1, maxLength: 20},
+	"22":   {minLength: 1, maxLength: 20},
+	"240":  {minLength: 1, maxLength: 30},
+	"241":  {minLength: 1, maxLength: 30},
+	"250":  {minLength: 1, maxLength: 30},
+	"251":  {minLength: 1, maxLength: 30},
+	"254":  {minLength: 1, maxLength: 20},
+	"30":   {minLength: 1, maxLength: 8, numeric: true},
+	"37":   {minLength: 1, maxLength: 8, numeric: true},
+	"400":  {minLength: 1, maxLength: 30},
+	"401":  {minLength: 1, maxLength: 30},
+	"402":  {minLength: 17, maxLength: 17, numeric: true, checkDigit: true},
+	"403":  {minLength: 1, maxLength: 30},
+	"410":  gs1GLN,
+	"411":  gs1GLN,
+	"412":  gs1GLN,
+	"413":  gs1GLN,
+	"414":  gs1GLN,
+	"415":  gs1GLN,
+	"416":  gs1GLN,
+	"417":  gs1GLN,
+	"420":  {minLength: 1, maxLength: 20},
+	"422":  {minLength: 3, maxLength: 3, numeric: true},
+	"7003": {minLength: 10, maxLength: 10, numeric: true},
+	"8004": {minLength: 1, maxLength: 30},
+	"8005": {minLength: 6, maxLength: 6, numeric: true},
+	"8020": {minLength: 1, maxLength: 25},
+	"90":   {minLength: 1, maxLength: 30},
+}
+
+// gs1PredefinedLengths holds the total element length of the AI prefixes that
+// need no separator after them.
+var gs1PredefinedLengths = map[string]int{
+	"00": 20, "01": 16, "02": 16, "03": 16, "04": 18,
+	"11": 8, "12": 8, "13": 8, "14": 8, "15": 8, "16": 8, "17": 8, "18": 8, "19": 8,
+	"20": 4,
+	"31": 10, "32": 10, "33": 10, "34": 10, "35": 10, "36": 10,
+	"41": 16,
+}
+
+// lookupGS1ApplicationIdentifier returns the value format of an AI.
+func lookupGS1ApplicationIdentifier(ai string) (gs1ApplicationIdentifier, bool) {
+	if format, ok := gs1ApplicationIdentifiers[ai]; ok {
+		return format, true
+	}
+	if !isDigit([]byte(ai)) {
+		return gs1ApplicationIdentifier{}, false
+	}
+	// Trade measures 310n-369n, where n is the number of decimal places.
+	if len(ai) == 4 && ai[:2] >= "31" && ai[:2] <= "36" {
+		return gs1Amount, true
+	}
+	// Company internal information 91-99.
+	if len(ai) == 2 && ai >= "91" && ai <= "99" {
+		return gs1ApplicationIdentifier{minLength: 1, maxLength: 90}, true
+	}
+	return gs1ApplicationIdentifier{}, false
+}
+
+// GS1CheckDigit returns the mod 10 check digit for a string of digits.
+func GS1CheckDigit(digits string) (int, error) {
+	if !isDigit([]byte(digits)) {
+		return 0, fmt.Errorf("invalid GS1 digits (%s)", digits)
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		weight := 1
+		if (len(digits)-1-i)%2 == 0 {
+			weight = 3
+		}
+		sum += int(digits[i]-'0') * weight
+	}
+	return (10 - sum%10) % 10, nil
+}
+
+// validate checks value against the format of the Application Identifier ai.
+func (f gs1ApplicationIdentifier) validate(ai, value string) error {
+	if len(value) < f.minLength || len(value) > f.maxLength {
+		if f.minLength == f.maxLength {
+			return fmt.Errorf("AI (%s) needs %d characters, got %d", ai, f.maxLength, len(value))
+		}
+		return fmt.Errorf("AI (%s) needs %d to %d characters, got %d", ai, f.minLength, f.maxLength, len(value))
+	}
+	if f.numeric && !isDigit([]byte(value)) {
+		return fmt.Errorf("AI (%s) value must be numeric (%s)", ai, value)
+	}
+	for _, c := range value {
+		if !strings.ContainsRune(gs1CharacterSet, c) {
+			return fmt.Errorf("AI (%s) value contains invalid character %q", ai, c)
+		}
+	}
+	if f.checkDigit {
+		check, err := GS1CheckDigit(value[:len(value)-1])
+		if err != nil {
+			return err
+		}
+		if int(value[len(value)-1]-'0') != check {
+			return fmt.Errorf("AI (%s) has invalid check digit in %s, expected %d", ai, value, check)
+		}
+	}
+	if f.date {
+		month := int(value[2]-'0')*10 + int(value[3]-'0')
+		day := int(value[4]-'0')*10 + int(value[5]-'0')
+		if month < 1 || month > 12 || day > 31 {
+			return fmt.Errorf("AI (%s) has invalid date %s", ai, value)
+		}
+	}
+	return nil
+}
+
+type gs1Element struct {
+	ai    string
+	value string
+}
+
+// GS1Builder assembles a GS1 element string from Application Identifiers and values.
+type GS1Builder struct {
+	elements []gs1Element
+}
+
+// NewGS1Builder creates an empty GS1Builder.
+func NewGS1Builder() *GS1Builder {
+	return &GS1Builder{}
+}
+
+// Add validates and appends an element. ai is the Application Identifier
+// without parentheses, such as "01".
+func (b *GS1Builder) Add(ai, value string) error {
+	format, ok := lookupGS1ApplicationIdentifier(ai)
+	if !ok {
+		return fmt.Errorf("unsupported GS1 application identifier (%s)", ai)
+	}
+	if err := format.validate(ai, value); err != nil {
+		return err
+	}
+	b.elements = append(b.elements, gs1Element{ai: ai, value: value})
+	return nil
+}
+
+// Bytes returns the element string, with a GS separator after every variable
+// length element except the last one.
+func (b *GS1Builder) Bytes() []byte {
+	var buf bytes.Buffer
+	for i, element := range b.elements {
+		buf.WriteString(element.ai)
+		buf.WriteString(element.value)
+		if _, ok := gs1PredefinedLengths[element.ai[:2]]; !ok && i < len(b.elements)-1 {
+			buf.WriteByte(GS)
+		}
+	}
+	return buf.Bytes()
+}
+
+// String returns the human readable form, such as "(01)09501101020917(10)AB12".
+func (b *GS1Builder) String() string {
+	var sb strings.Builder
+	for _, element := range b.elements {
+		sb.WriteString("(" + element.ai + ")" + element.value)
+	}
+	return sb.String()
+}
+
+// Segments returns the data segments of the element string for a symbol in
+// FNC1 mode. The FNC1 mode indicator itself is not included.
+func (b *GS1Builder) Segments() ([]*QRData, error) {
+	return NewFNC1Data(b.Bytes())
+}
+
+// NewFNC1FirstData creates the FNC1 in first position mode indicator used by GS1 symbols.
+func NewFNC1FirstData() *QRData {
+	return &QRData{mode: ModeFNC1First}
+}
+
+// NewFNC1SecondData creates the FNC1 in second position mode indicator. The
+// application indicator is either two digits or a single Latin letter.
+func NewFNC1SecondData(applicationIndicator string) (*QRData, error) {
+	var value int
+	switch {
+	case len(applicationIndicator) == 2 && isDigit([]byte(applicationIndicator)):
+		value = int(applicationIndicator[0]-'0')*10 + int(applicationIndicator[1]-'0')
+	case len(applicationIndicator) == 1 &&
+		(applicationIndicator[0] >= 'a' && applicationIndicator[0] <= 'z' ||
+			applicationIndicator[0] >= 'A' && applicationIndicator[0] <= 'Z'):
+		value = int(applicationIndicator[0]) + 100
+	default:
+		return nil, fmt.Errorf("invalid FNC1 application indicator (%s)", applicationIndicator)
+	}
+	return &QRData{
+		data: []byte{byte(value)},
+		mode: ModeFNC1Second,
+	}, nil
+}
+
+// NewFNC1Data encodes data for a symbol in FNC1 mode. When the data fits the
+// alphanumeric character set, GS separators are written as "%" and literal
+// "%" characters are doubled, otherwise the data is kept in byte mode.
+func NewFNC1Data(data []byte) ([]*QRData, error) {
+	escaped := bytes.ReplaceAll(data, []byte("%"), []byte("%%"))
+	escaped = bytes.ReplaceAll(escaped, []byte{GS}, []byte("%"))
+
+	if ReAlphaNumeric.Match(escaped) {
+		segment, err := NewQRData(escaped, 0, true)
+		if err != nil {
+			return nil, err
+		}
+		return []*QRData{segment}, nil
+	}
+	segment, err := NewQRData(data, ModeByte, true)
+	if err != nil {
+		return nil, err
+	}
+	return []*QRData{segment}, nil
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGS1CheckDigit(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   int
+	}{
+		// GTIN-13 9501101530003 and GTIN-14 09501101020917.
+		{"950110153000", 3},
+		{"0950110102091", 7},
+		// SSCC 106141411234567897.
+		{"10614141123456789", 7},
+		{"0", 0},
+		{"1", 7},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		got, err := GS1CheckDigit(tt.digits)
+		if err != nil {
+			t.Errorf("GS1CheckDigit(%q): %v", tt.digits, err)
+		} else if got != tt.want {
+			t.Errorf("GS1CheckDigit(%q) = %d, want %d", tt.digits, got, tt.want)
+		}
+	}
+	for _, digits := range []string{"12a4", "-1", "1 2"} {
+		if _, err := GS1CheckDigit(digits); err == nil {
+			t.Errorf("GS1CheckDigit(%q) accepted non-digits", digits)
+		}
+	}
+}
+
+func TestGS1Builder(t *testing.T) {
+	type element struct{ ai, value string }
+	tests := []struct {
+		elements []element
+		want     string
+	}{
+		// A fixed length AI needs no separator.
+		{[]element{{"01", "09501101020917"}, {"17", "251231"}}, "010950110102091717251231"},
+		// A variable length AI is followed by GS unless it is the last one.
+		{[]element{{"10", "AB12"}, {"01", "09501101020917"}}, "10AB12\x1d0109501101020917"},
+		{[]element{{"01", "09501101020917"}, {"10", "AB12"}}, "010950110102091710AB12"},
+		{[]element{{"10", "AB12"}, {"21", "S1"}, {"3103", "000125"}}, "10AB12\x1d21S1\x1d3103000125"},
+		{[]element{{"3103", "000125"}, {"21", "S1"}}, "310300012521S1"},
+	}
+	for _, tt := range tests {
+		b := NewGS1Builder()
+		for _, e := range tt.elements {
+			if err := b.Add(e.ai, e.value); err != nil {
+				t.Fatalf("Add(%q, %q): %v", e.ai, e.value, err)
+			}
+		}
+		if got := b.Bytes(); string(got) != tt.want {
+			t.Errorf("%s: got %q, want %q", b, got, tt.want)
+		}
+	}
+
+	invalid := []struct{ ai, value string }{
+		{"01", "09501101020918"}, // Wrong check digit.
+		{"01", "0950110102091"},  // Too short.
+		{"17", "251301"},         // Month 13.
+		{"10", "AB#12"},          // Not in the GS1 character set.
+		{"10", "123456789012345678901"},
+		{"30", "12A"},
+		{"05", "1"},
+	}
+	for _, tt := range invalid {
+		if err := NewGS1Builder().Add(tt.ai, tt.value); err == nil {
+			t.Errorf("Add(%q, %q) accepted an invalid element", tt.ai, tt.value)
+		}
+	}
+}
+
+func TestNewFNC1Data(t *testing.T) {
+	tests := []struct {
+		data string
+		mode int
+		want string
+	}{
+		{"0109501101020917", ModeNumeric, "0109501101020917"},
+		// GS becomes "%" and a literal "%" is doubled in alphanumeric mode.
+		{"10AB12\x1d2112", ModeAlphanumeric, "10AB12%2112"},
+		{"10AB%12\x1d21%", ModeAlphanumeric, "10AB%%12%21%%"},
+		{"%%", ModeAlphanumeric, "%%%%"},
+		// Byte mode keeps the separator and "%" as they are.
+		{"10ab%12\x1d21", ModeByte, "10ab%12\x1d21"},
+	}
+	for _, tt := range tests {
+		segments, err := NewFNC1Data([]byte(tt.data))
+		if err != nil {
+			t.Fatalf("NewFNC1Data(%q): %v", tt.data, err)
+		}
+		if len(segments) != 1 {
+			t.Fatalf("NewFNC1Data(%q): got %d segments, want 1", tt.data, len(segments))
+		}
+		if got := segments[0]; got.GetMode() != tt.mode || got.String() != tt.want {
+			t.Errorf("NewFNC1Data(%q) = mode %d %q, want mode %d %q", tt.data, got.GetMode(), got, tt.mode, tt.want)
+		}
+	}
+
+	// The data passed in is left untouched.
+	data := []byte("10AB%12\x1d21")
+	if _, err := NewFNC1Data(data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte("10AB%12\x1d21")) {
+		t.Errorf("NewFNC1Data changed its input to %q", data)
+	}
+}
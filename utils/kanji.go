@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"fmt"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// Shift-JIS code ranges that can be represented in Kanji mode.
+const (
+	kanjiRange1Start = 0x8140
+	kanjiRange1End   = 0x9FFC
+	kanjiRange2Start = 0xE040
+	kanjiRange2End   = 0xEBBF
+)
+
+// ToShiftJIS converts UTF-8 text to Shift-JIS bytes.
+func ToShiftJIS(data []byte) ([]byte, error) {
+	encoded, err := japanese.ShiftJIS.NewEncoder().Bytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert data to Shift-JIS: %w", err)
+	}
+	return encoded, nil
+}
+
+// FromShiftJIS converts Shift-JIS bytes back to UTF-8 text.
+func FromShiftJIS(data []byte) ([]byte, error) {
+	decoded, err := japanese.ShiftJIS.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode Shift-JIS data: %w", err)
+	}
+	return decoded, nil
+}
+
+// IsKanji reports whether UTF-8 text consists only of double-byte characters
+// that fit the Kanji mode ranges of Shift-JIS.
+func IsKanji(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	sjis, err := ToShiftJIS(data)
+	if err != nil {
+		return false
+	}
+	return isShiftJISKanji(sjis)
+}
+
+// isShiftJISKanji reports whether Shift-JIS bytes are a sequence of Kanji mode characters.
+func isShiftJISKanji(sjis []byte) bool {
+	if len(sjis)%2 != 0 {
+		return false
+	}
+	for i := 0; i < len(sjis); i += 2 {
+		code := int(sjis[i])<<8 | int(sjis[i+1])
+		if !(code >= kanjiRange1Start && code <= kanjiRange1End) &&
+			!(code >= kanjiRange2Start && code <= kanjiRange2End) {
+			return false
+		}
+	}
+	return true
+}
+
+// kanjiValue returns the 13-bit value of a Shift-JIS Kanji mode character.
+func kanjiValue(code int) int {
+	if code <= kanjiRange1End {
+		code -= kanjiRange1Start
+	} else {
+		code -= 0xC140
+	}
+	return (code>>8)*0xC0 + (code & 0xFF)
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// bitString returns the first b.Len() bits of the buffer as a string of 0s and 1s.
+func bitString(b *BitBuffer) string {
+	var s strings.Builder
+	for i := 0; i < b.Len(); i++ {
+		if b.Get(i) {
+			s.WriteByte('1')
+		} else {
+			s.WriteByte('0')
+		}
+	}
+	return s.String()
+}
+
+func TestIsShiftJISKanji(t *testing.T) {
+	tests := []struct {
+		sjis []byte
+		want bool
+	}{
+		{[]byte{0x81, 0x40}, true},
+		{[]byte{0x81, 0x3F}, false},
+		{[]byte{0x9F, 0xFC}, true},
+		{[]byte{0x9F, 0xFD}, false},
+		{[]byte{0xE0, 0x3F}, false},
+		{[]byte{0xE0, 0x40}, true},
+		{[]byte{0xEB, 0xBF}, true},
+		{[]byte{0xEB, 0xC0}, false},
+		{[]byte{0xA0, 0x40}, false},
+		{[]byte{0x93, 0x5F, 0xE4, 0xAA}, true},
+		{[]byte{0x93, 0x5F, 0x41, 0x42}, false},
+		{[]byte{0x93}, false},
+		{[]byte{}, true},
+	}
+	for _, tt := range tests {
+		if got := isShiftJISKanji(tt.sjis); got != tt.want {
+			t.Errorf("isShiftJISKanji(% X) = %v, want %v", tt.sjis, got, tt.want)
+		}
+	}
+}
+
+func TestKanjiValue(t *testing.T) {
+	tests := []struct {
+		code, want int
+	}{
+		{0x8140, 0x0000},
+		{0x9FFC, 0x173C},
+		{0xE040, 0x1740},
+		{0xEBBF, 0x1FFF},
+		// The examples of ISO/IEC 18004 section 7.4.6.
+		{0x935F, 0x0D9F},
+		{0xE4AA, 0x1AAA},
+	}
+	for _, tt := range tests {
+		if got := kanjiValue(tt.code); got != tt.want {
+			t.Errorf("kanjiValue(%#X) = %#X, want %#X", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestKanjiSegment(t *testing.T) {
+	if !IsKanji([]byte("点茗")) || IsKanji([]byte("点A")) || IsKanji(nil) {
+		t.Error("IsKanji misclassifies the test strings")
+	}
+
+	data, err := NewQRData([]byte("点茗"), ModeKanji, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := NewBitBuffer()
+	if err := data.WriteSegment(buffer, 1); err != nil {
+		t.Fatal(err)
+	}
+	// Mode indicator, 8-bit character count and two 13-bit values, as in the
+	// example of ISO/IEC 18004 section 7.4.6.
+	want := "1000" + "00000010" + "0110110011111" + "1101010101010"
+	if got := bitString(buffer); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if _, err := NewQRData([]byte("kana"), ModeKanji, true); err == nil {
+		t.Error("NewQRData accepted ASCII text in Kanji mode")
+	}
+}
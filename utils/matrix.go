@@ -0,0 +1,101 @@
+package utils
+
+import "math/bits"
+
+// BitMatrix holds the modules of a symbol packed 64 to a word, each row
+// starting on a new word. A second bitset marks the function modules, such
+// as finder, timing and alignment patterns and format information, which
+// data placement skips.
+type BitMatrix struct {
+	width    int
+	height   int
+	stride   int
+	dark     []uint64
+	function []uint64
+}
+
+// NewBitMatrix creates a light matrix without function modules.
+func NewBitMatrix(width, height int) *BitMatrix {
+	stride := (width + 63) / 64
+	return &BitMatrix{
+		width:    width,
+		height:   height,
+		stride:   stride,
+		dark:     make([]uint64, stride*height),
+		function: make([]uint64, stride*height),
+	}
+}
+
+func (m *BitMatrix) Width() int {
+	return m.width
+}
+
+func (m *BitMatrix) Height() int {
+	return m.height
+}
+
+// InBounds reports whether row, col lies inside the matrix.
+func (m *BitMatrix) InBounds(row, col int) bool {
+	return row >= 0 && row < m.height && col >= 0 && col < m.width
+}
+
+func (m *BitMatrix) index(row, col int) (int, uint64) {
+	return row*m.stride + col>>6, 1 << (col & 63)
+}
+
+// Get reports whether the module at row, col is dark. Modules outside the
+// matrix are light.
+func (m *BitMatrix) Get(row, col int) bool {
+	if !m.InBounds(row, col) {
+		return false
+	}
+	i, bit := m.index(row, col)
+	return m.dark[i]&bit != 0
+}
+
+// IsFunction reports whether the module at row, col belongs to a function pattern.
+func (m *BitMatrix) IsFunction(row, col int) bool {
+	if !m.InBounds(row, col) {
+		return false
+	}
+	i, bit := m.index(row, col)
+	return m.function[i]&bit != 0
+}
+
+// Set sets the color of the module at row, col.
+func (m *BitMatrix) Set(row, col int, dark bool) {
+	i, bit := m.index(row, col)
+	if dark {
+		m.dark[i] |= bit
+	} else {
+		m.dark[i] &^= bit
+	}
+}
+
+// SetFunction sets the color of the module at row, col and marks it as a
+// function module.
+func (m *BitMatrix) SetFunction(row, col int, dark bool) {
+	m.Set(row, col, dark)
+	i, bit := m.index(row, col)
+	m.function[i] |= bit
+}
+
+// Clone returns a copy of the matrix.
+func (m *BitMatrix) Clone() *BitMatrix {
+	return &BitMatrix{
+		width:    m.width,
+		height:   m.height,
+		stride:   m.stride,
+		dark:     append([]uint64(nil), m.dark...),
+		function: append([]uint64(nil), m.function...),
+	}
+}
+
+// DarkCount returns the number of dark modules.
+func (m *BitMatrix) DarkCount() int {
+	count := 0
+	for _, word := range m.dark {
+		count += bits.OnesCount64(word)
+	}
+	return count
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"fmt"
+	"qrcode/base"
+	"qrcode/constants"
+)
+
+// Micro QR mode indicators, written with version-1 bits.
+var MicroModeIndicator = map[int]int{
+	ModeNumeric:      0,
+	ModeAlphanumeric: 1,
+	ModeByte:         2,
+	ModeKanji:        3,
+}
+
+// Character count indicator lengths of the Micro QR versions M1-M4.
+// A zero length means the version does not support the mode.
+var MicroModeSize = map[int][4]int{
+	ModeNumeric:      {3, 4, 5, 6},
+	ModeAlphanumeric: {0, 3, 4, 5},
+	ModeByte:         {0, 0, 4, 5},
+	ModeKanji:        {0, 0, 3, 4},
+}
+
+// MicroMaskPatterns maps the four Micro QR masks to the QR mask patterns they share.
+var MicroMaskPatterns = []int{1, 4, 6, 7}
+
+const G15_MICRO_MASK = (1 << 14) | (1 << 10) | (1 << 6) | (1 << 2) | (1 << 0)
+
+// BCHMicroTypeInfo calculates BCH code for Micro QR type information.
+func BCHMicroTypeInfo(data int) int {
+	return BCHTypeInfo(data) ^ G15_MASK ^ G15_MICRO_MASK
+}
+
+func CheckMicroVersion(version int) bool {
+	return version >= 1 && version <= 4
+}
+
+// MicroLengthInBits returns the character count length of mode in the Micro QR version.
+func MicroLengthInBits(mode int, version int) (int, error) {
+	if !CheckMicroVersion(version) {
+		return 0, fmt.Errorf("invalid micro version (M%d)", version)
+	}
+	sizes, ok := MicroModeSize[mode]
+	if !ok || sizes[version-1] == 0 {
+		return 0, fmt.Errorf("mode %d is not supported by micro version M%d", mode, version)
+	}
+	return sizes[version-1], nil
+}
+
+// MicroDataBits returns the data capacity in bits. M1 and M3 end with a
+// 4-bit data codeword.
+func MicroDataBits(version int, errorCorrection constants.ErrorCorrectionLevel) (int, error) {
+	rsBlocks, err := base.MicroRSBlocks(version, errorCorrection)
+	if err != nil {
+		return 0, err
+	}
+	bits := rsBlocks[0].DataCount * 8
+	if version == 1 || version == 3 {
+		bits -= 4
+	}
+	return bits, nil
+}
+
+// WriteMicroSegment writes the segment with the Micro QR mode indicator and character count.
+func (q *QRData) WriteMicroSegment(buffer *BitBuffer, version int) error {
+	length, err := MicroLengthInBits(q.mode, version)
+	if err != nil {
+		return err
+	}
+	buffer.Put(MicroModeIndicator[q.mode], version-1)
+	buffer.Put(q.Len(), length)
+	q.Write(buffer)
+	return nil
+}
+
+// CreateMicroData encodes the data list of a Micro QR symbol and returns its
+// data codewords followed by the error correction codewords.
+func CreateMicroData(version int, errorCorrection constants.ErrorCorrectionLevel, dataList []*QRData) ([]byte, error) {
+	buffer := NewBitBuffer()
+	for _, data := range dataList {
+		if err := data.WriteMicroSegment(buffer, version); err != nil {
+			return nil, err
+		}
+	}
+
+	rsBlocks, err := base.MicroRSBlocks(version, errorCorrection)
+	if err != nil {
+		return nil, err
+	}
+	bitLimit, err := MicroDataBits(version, errorCorrection)
+	if err != nil {
+		return nil, err
+	}
+	if buffer.Len() > bitLimit {
+		return nil, NewDataOverflowError(buffer.Len(), bitLimit)
+	}
+
+	// Terminate the bits (add up to 3, 5, 7 or 9 0s).
+	for i := 0; i < min(bitLimit-buffer.Len(), 2*version+1); i++ {
+		buffer.PutBit(false)
+	}
+
+	// Delimit the string into 8-bit words, padding with 0s if necessary.
+	for buffer.Len()%8 != 0 && buffer.Len() < bitLimit {
+		buffer.PutBit(false)
+	}
+
+	// Add special alternating padding bitstrings, leaving a final 4-bit codeword empty.
+	for i := 0; bitLimit-buffer.Len() >= 8; i++ {
+		if i%2 == 0 {
+			buffer.Put(PAD0, 8)
+		} else {
+			buffer.Put(PAD1, 8)
+		}
+	}
+	for buffer.Len() < bitLimit {
+		buffer.PutBit(false)
+	}
+
+	return CreateBytes(buffer, rsBlocks)
+}
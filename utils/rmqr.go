@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"fmt"
+	"qrcode/base"
+	"qrcode/constants"
+)
+
+// RMQRSize is the height and width in modules of a rMQR version.
+type RMQRSize struct {
+	Height int
+	Width  int
+}
+
+// RMQRSizes lists the rMQR versions R7x43-R17x139, in version indicator order.
+var RMQRSizes = []RMQRSize{
+	{7, 43}, {7, 59}, {7, 77}, {7, 99}, {7, 139},
+	{9, 43}, {9, 59}, {9, 77}, {9, 99}, {9, 139},
+	{11, 27}, {11, 43}, {11, 59}, {11, 77}, {11, 99}, {11, 139},
+	{13, 27}, {13, 43}, {13, 59}, {13, 77}, {13, 99}, {13, 139},
+	{15, 43}, {15, 59}, {15, 77}, {15, 99}, {15, 139},
+	{17, 43}, {17, 59}, {17, 77}, {17, 99}, {17, 139},
+}
+
+// String returns the version name, such as "R7x43".
+func (s RMQRSize) String() string {
+	return fmt.Sprintf("R%dx%d", s.Height, s.Width)
+}
+
+// RMQRAlignmentColumns holds the alignment pattern center columns by symbol width.
+var RMQRAlignmentColumns = map[int][]int{
+	27:  {},
+	43:  {21},
+	59:  {19, 39},
+	77:  {25, 51},
+	99:  {23, 49, 75},
+	139: {27, 55, 83, 111},
+}
+
+// rMQR mode indicators, written with 3 bits.
+var RMQRModeIndicator = map[int]int{
+	ModeNumeric:      1,
+	ModeAlphanumeric: 2,
+	ModeByte:         3,
+	ModeKanji:        4,
+	ModeFNC1First:    5,
+	ModeFNC1Second:   6,
+	ModeECI:          7,
+}
+
+// Character count indicator lengths of the rMQR versions, in the order
+// numeric, alphanumeric, byte and Kanji.
+var RMQRModeSize = [][4]int{
+	{4, 3, 3, 2}, {5, 5, 4, 3}, {6, 5, 5, 4}, {7, 6, 5, 5}, {7, 6, 6, 5},
+	{5, 5, 4, 3}, {6, 5, 5, 4}, {7, 6, 5, 5}, {7, 6, 6, 5}, {8, 7, 6, 6},
+	{4, 4, 3, 2}, {6, 5, 5, 4}, {7, 6, 5, 5}, {7, 6, 6, 5}, {8, 7, 6, 6}, {8, 7, 7, 6},
+	{5, 5, 4, 3}, {6, 6, 5, 5}, {7, 6, 6, 5}, {7, 7, 6, 5}, {8, 7, 7, 6}, {8, 8, 7, 7},
+	{7, 6, 6, 5}, {7, 7, 6, 5}, {8, 7, 7, 6}, {8, 7, 7, 6}, {9, 8, 7, 7},
+	{7, 6, 6, 5}, {8, 7, 6, 6}, {8, 7, 7, 6}, {8, 8, 7, 6}, {9, 8, 8, 7},
+}
+
+// Format information masks next to the finder and the sub-finder pattern.
+const (
+	RMQR_FINDER_MASK     = 0b011111101010110010
+	RMQR_SUB_FINDER_MASK = 0b100000101001111011
+)
+
+// RMQR_MASK_PATTERN is the only data mask rMQR uses, shared with QR mask 4.
+const RMQR_MASK_PATTERN = 4
+
+func CheckRMQRVersion(version int) bool {
+	return version >= 1 && version <= len(RMQRSizes)
+}
+
+// RMQRVersion returns the version number of the rMQR symbol with the given size.
+func RMQRVersion(height, width int) (int, error) {
+	for i, size := range RMQRSizes {
+		if size.Height == height && size.Width == width {
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid rMQR size (R%dx%d)", height, width)
+}
+
+// BCHRMQRFormatInfo calculates the 18-bit BCH code of rMQR format information.
+func BCHRMQRFormatInfo(data int) int {
+	return BCHTypeNumber(data)
+}
+
+// RMQRLengthInBits returns the character count length of mode in the rMQR version.
+func RMQRLengthInBits(mode int, version int) (int, error) {
+	if !CheckRMQRVersion(version) {
+		return 0, fmt.Errorf("invalid rMQR version (%d)", version)
+	}
+	sizes := RMQRModeSize[version-1]
+	switch mode {
+	case ModeNumeric:
+		return sizes[0], nil
+	case ModeAlphanumeric:
+		return sizes[1], nil
+	case ModeByte:
+		return sizes[2], nil
+	case ModeKanji:
+		return sizes[3], nil
+	}
+	return 0, fmt.Errorf("invalid mode (%d)", mode)
+}
+
+// WriteRMQRSegment writes the segment with the rMQR mode indicator and character count.
+func (q *QRData) WriteRMQRSegment(buffer *BitBuffer, version int) error {
+	indicator, ok := RMQRModeIndicator[q.mode]
+	if !ok {
+		return fmt.Errorf("mode %d is not supported by rMQR", q.mode)
+	}
+	buffer.Put(indicator, 3)
+	if q.hasCharacterCount() {
+		length, err := RMQRLengthInBits(q.mode, version)
+		if err != nil {
+			return err
+		}
+		buffer.Put(q.Len(), length)
+	}
+	q.Write(buffer)
+	return nil
+}
+
+// CreateRMQRData encodes the data list of a rMQR symbol and returns the
+// interleaved data and error correction codewords.
+func CreateRMQRData(version int, errorCorrection constants.ErrorCorrectionLevel, dataList []*QRData) ([]byte, error) {
+	buffer := NewBitBuffer()
+	for _, data := range dataList {
+		if err := data.WriteRMQRSegment(buffer, version); err != nil {
+			return nil, err
+		}
+	}
+
+	rsBlocks, err := base.RMQRRSBlocks(version, errorCorrection)
+	if err != nil {
+		return nil, err
+	}
+
+	bitLimit := 0
+	for _, block := range rsBlocks {
+		bitLimit += block.DataCount * 8
+	}
+	if buffer.Len() > bitLimit {
+		return nil, NewDataOverflowError(buffer.Len(), bitLimit)
+	}
+
+	// Terminate the bits (add up to three 0s).
+	for i := 0; i < min(bitLimit-buffer.Len(), 3); i++ {
+		buffer.PutBit(false)
+	}
+
+	// Delimit the string into 8-bit words, padding with 0s if necessary.
+	delimit := buffer.Len() % 8
+	if delimit != 0 {
+		for i := 0; i < 8-delimit; i++ {
+			buffer.PutBit(false)
+		}
+	}
+
+	// Add special alternating padding bitstrings until buffer is full.
+	bytesToFill := (bitLimit - buffer.Len()) / 8
+	for i := 0; i < bytesToFill; i++ {
+		if i%2 == 0 {
+			buffer.Put(PAD0, 8)
+		} else {
+			buffer.Put(PAD1, 8)
+		}
+	}
+
+	return CreateBytes(buffer, rsBlocks)
+}
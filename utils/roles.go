@@ -0,0 +1,84 @@
+package utils
+
+// ModuleRole tells what a module of a symbol is used for.
+type ModuleRole uint8
+
+const (
+	// RoleNone is returned for positions outside the symbol.
+	RoleNone ModuleRole = iota
+	RoleFinder
+	RoleSeparator
+	RoleTiming
+	RoleAlignment
+	RoleFormatInfo
+	RoleVersionInfo
+	// RoleDarkModule is the single dark module next to the bottom left format information.
+	RoleDarkModule
+	RoleData
+	RoleErrorCorrection
+	RoleRemainder
+)
+
+var moduleRoleNames = []string{
+	RoleNone:            "none",
+	RoleFinder:          "finder",
+	RoleSeparator:       "separator",
+	RoleTiming:          "timing",
+	RoleAlignment:       "alignment",
+	RoleFormatInfo:      "format info",
+	RoleVersionInfo:     "version info",
+	RoleDarkModule:      "dark module",
+	RoleData:            "data",
+	RoleErrorCorrection: "error correction",
+	RoleRemainder:       "remainder",
+}
+
+func (r ModuleRole) String() string {
+	if int(r) < len(moduleRoleNames) {
+		return moduleRoleNames[r]
+	}
+	return "unknown"
+}
+
+// IsFunction reports whether the role belongs to a function pattern rather
+// than to the encoding region.
+func (r ModuleRole) IsFunction() bool {
+	return r != RoleNone && r < RoleData
+}
+
+// RoleMap holds the role of every module of a symbol.
+type RoleMap struct {
+	width  int
+	height int
+	roles  []ModuleRole
+}
+
+// NewRoleMap creates a role map with every module set to RoleNone.
+func NewRoleMap(width, height int) *RoleMap {
+	return &RoleMap{
+		width:  width,
+		height: height,
+		roles:  make([]ModuleRole, width*height),
+	}
+}
+
+func (m *RoleMap) Width() int {
+	return m.width
+}
+
+func (m *RoleMap) Height() int {
+	return m.height
+}
+
+// Role returns the role of the module at row, col, or RoleNone outside the symbol.
+func (m *RoleMap) Role(row, col int) ModuleRole {
+	if row < 0 || row >= m.height || col < 0 || col >= m.width {
+		return RoleNone
+	}
+	return m.roles[row*m.width+col]
+}
+
+// Set sets the role of the module at row, col.
+func (m *RoleMap) Set(row, col int, role ModuleRole) {
+	m.roles[row*m.width+col] = role
+}
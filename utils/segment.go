@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// segmentModes lists the modes the segmenter chooses from.
+var segmentModes = []int{ModeNumeric, ModeAlphanumeric, ModeByte, ModeKanji}
+
+// segmentUnitsPerBit scales character costs so that numeric (10 bits per 3
+// digits) and alphanumeric (11 bits per 2 characters) stay whole numbers.
+const segmentUnitsPerBit = 6
+
+// NewSegment creates a segment in an explicit mode, one of ModeNumeric,
+// ModeAlphanumeric, ModeByte or ModeKanji. Unlike NewQRData it never picks
+// the mode itself and always checks that data can be represented in it.
+// Kanji data is given as UTF-8 text. data is copied.
+func NewSegment(data []byte, mode int) (*QRData, error) {
+	switch mode {
+	case ModeNumeric, ModeAlphanumeric, ModeByte, ModeKanji:
+	default:
+		return nil, fmt.Errorf("invalid mode (%d)", mode)
+	}
+	return NewQRData(append([]byte(nil), data...), mode, true)
+}
+
+// OptimalDataChunks splits data into the segments with the shortest total bit
+// length in the given version. It weighs the per character cost of numeric,
+// alphanumeric, byte and Kanji mode against the mode indicator and character
+// count bits every new segment costs in that version.
+func OptimalDataChunks(data []byte, version int) ([]*QRData, error) {
+	data = toBytes(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if !CheckVersion(version) {
+		version = 1
+	}
+	modeSizes := ModeSizeVersion(version)
+
+	// Split the data into characters, remembering which modes can hold each.
+	type character struct {
+		start, end int
+		modes      map[int]bool
+	}
+	encoder := japanese.ShiftJIS.NewEncoder()
+	var chars []character
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		c := character{start: i, end: i + size, modes: map[int]bool{ModeByte: true}}
+		if size == 1 {
+			if isDigit(data[i : i+1]) {
+				c.modes[ModeNumeric] = true
+			}
+			if ReAlphaNumeric.Match(data[i : i+1]) {
+				c.modes[ModeAlphanumeric] = true
+			}
+		} else if r != utf8.RuneError {
+			if sjis, err := encoder.Bytes(data[i : i+size]); err == nil && isShiftJISKanji(sjis) {
+				c.modes[ModeKanji] = true
+			}
+		}
+		chars = append(chars, c)
+		i += size
+	}
+
+	charCost := func(mode int, c character) int {
+		switch mode {
+		case ModeNumeric:
+			return 10 * segmentUnitsPerBit / 3
+		case ModeAlphanumeric:
+			return 11 * segmentUnitsPerBit / 2
+		case ModeKanji:
+			return 13 * segmentUnitsPerBit
+		default:
+			return 8 * segmentUnitsPerBit * (c.end - c.start)
+		}
+	}
+	headerCost := func(mode int) int {
+		return (4 + modeSizes[mode]) * segmentUnitsPerBit
+	}
+	// roundUp rounds a cost up to whole bits, which closing a segment does.
+	roundUp := func(cost int) int {
+		return (cost + segmentUnitsPerBit - 1) / segmentUnitsPerBit * segmentUnitsPerBit
+	}
+
+	// costs[i][m] is the cheapest encoding of the first i characters that ends
+	// with an open segment in mode m. from and starts record how it was reached.
+	const unreachable = -1
+	costs := make([][]int, len(chars)+1)
+	from := make([][]int, len(chars)+1)
+	starts := make([][]bool, len(chars)+1)
+	for i := range costs {
+		costs[i] = make([]int, len(segmentModes))
+		from[i] = make([]int, len(segmentModes))
+		starts[i] = make([]bool, len(segmentModes))
+		for m := range costs[i] {
+			costs[i][m] = unreachable
+		}
+	}
+
+	for i, c := range chars {
+		// The cheapest way to close the segment before character i.
+		closed, closedMode := 0, 0
+		if i > 0 {
+			closed = unreachable
+			for k := range segmentModes {
+				if costs[i][k] != unreachable && (closed == unreachable || roundUp(costs[i][k]) < closed) {
+					closed, closedMode = roundUp(costs[i][k]), k
+				}
+			}
+		}
+
+		for m, mode := range segmentModes {
+			if !c.modes[mode] {
+				continue
+			}
+			best := closed + headerCost(mode) + charCost(mode, c)
+			from[i+1][m], starts[i+1][m] = closedMode, true
+			if costs[i][m] != unreachable {
+				if cost := costs[i][m] + charCost(mode, c); cost <= best {
+					best = cost
+					from[i+1][m], starts[i+1][m] = m, false
+				}
+			}
+			costs[i+1][m] = best
+		}
+	}
+
+	// Pick the cheapest final mode and walk back through the segments.
+	end := len(chars)
+	m := -1
+	for k := range segmentModes {
+		if costs[end][k] != unreachable && (m < 0 || roundUp(costs[end][k]) < roundUp(costs[end][m])) {
+			m = k
+		}
+	}
+
+	var result []*QRData
+	segmentEnd := end
+	for i := end; i > 0; i-- {
+		if !starts[i][m] {
+			continue
+		}
+		chunk := data[chars[i-1].start:chars[segmentEnd-1].end]
+		segment, err := NewQRData(chunk, segmentModes[m], false)
+		if err != nil {
+			return nil, err
+		}
+		result = append([]*QRData{segment}, result...)
+		segmentEnd = i - 1
+		m = from[i][m]
+	}
+	return result, nil
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// segmentsBits returns the bit length of the segments written in version.
+func segmentsBits(t *testing.T, segments []*QRData, version int) int {
+	t.Helper()
+	buffer := NewBitBuffer()
+	for _, segment := range segments {
+		if err := segment.WriteSegment(buffer, version); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buffer.Len()
+}
+
+// minimalBits finds the shortest encoding of text in version by trying every
+// split into runs of characters and every mode for each run.
+func minimalBits(t *testing.T, text string, version int) int {
+	t.Helper()
+	chars := strings.Split(text, "")
+	best := make([]int, len(chars)+1)
+	for i := len(chars) - 1; i >= 0; i-- {
+		best[i] = -1
+		for j := i + 1; j <= len(chars); j++ {
+			for _, mode := range segmentModes {
+				segment, err := NewSegment([]byte(strings.Join(chars[i:j], "")), mode)
+				if err != nil {
+					continue
+				}
+				if bits := segmentsBits(t, []*QRData{segment}, version) + best[j]; best[i] < 0 || bits < best[i] {
+					best[i] = bits
+				}
+			}
+		}
+	}
+	return best[0]
+}
+
+func TestOptimalDataChunks(t *testing.T) {
+	type segment struct {
+		mode int
+		text string
+	}
+	tests := []struct {
+		text    string
+		version int
+		want    []segment
+		bits    int
+	}{
+		{"0123456789", 1, []segment{{ModeNumeric, "0123456789"}}, 48},
+		// Three digits do not pay for a numeric segment of their own.
+		{"ABC123", 1, []segment{{ModeAlphanumeric, "ABC123"}}, 46},
+		{"ABC0123456789", 1, []segment{{ModeAlphanumeric, "ABC"}, {ModeNumeric, "0123456789"}}, 78},
+		{"a1234567", 1, []segment{{ModeByte, "a"}, {ModeNumeric, "1234567"}}, 58},
+		{"a123456", 1, []segment{{ModeByte, "a"}, {ModeNumeric, "123456"}}, 54},
+		{"a12", 1, []segment{{ModeByte, "a12"}}, 36},
+		{"点茗", 1, []segment{{ModeKanji, "点茗"}}, 38},
+		{"点茗123", 1, []segment{{ModeKanji, "点茗"}, {ModeNumeric, "123"}}, 62},
+		{"abc点茗", 1, []segment{{ModeByte, "abc"}, {ModeKanji, "点茗"}}, 74},
+		// Ties between a mode switch and a single segment go to the mode
+		// that comes first in segmentModes: each of these takes as many bits
+		// in a single segment.
+		{"a123", 1, []segment{{ModeByte, "a"}, {ModeNumeric, "123"}}, 44},
+		{"点A", 1, []segment{{ModeKanji, "点"}, {ModeAlphanumeric, "A"}}, 44},
+		{"ABC0123456", 1, []segment{{ModeAlphanumeric, "ABC"}, {ModeNumeric, "0123456"}}, 68},
+		// Longer character counts in later versions make a switch dearer.
+		{"ABC01234567", 1, []segment{{ModeAlphanumeric, "ABC"}, {ModeNumeric, "01234567"}}, 71},
+		{"ABC01234567", 27, []segment{{ModeAlphanumeric, "ABC01234567"}}, 78},
+	}
+	for _, tt := range tests {
+		segments, err := OptimalDataChunks([]byte(tt.text), tt.version)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.text, err)
+		}
+		var got []segment
+		for _, s := range segments {
+			got = append(got, segment{s.GetMode(), s.String()})
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q version %d: got %v, want %v", tt.text, tt.version, got, tt.want)
+		} else {
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("%q version %d: got %v, want %v", tt.text, tt.version, got, tt.want)
+					break
+				}
+			}
+		}
+		if bits := segmentsBits(t, segments, tt.version); bits != tt.bits {
+			t.Errorf("%q version %d: got %d bits, want %d", tt.text, tt.version, bits, tt.bits)
+		}
+		if bits := minimalBits(t, tt.text, tt.version); bits != tt.bits {
+			t.Errorf("%q version %d: the shortest encoding takes %d bits, want %d", tt.text, tt.version, bits, tt.bits)
+		}
+	}
+
+	if segments, err := OptimalDataChunks(nil, 1); err != nil || segments != nil {
+		t.Errorf("empty data: got %v, %v", segments, err)
+	}
+}
+
+// TestOptimalDataChunksMinimal compares random mixed text against the
+// shortest encoding found by minimalBits.
+func TestOptimalDataChunksMinimal(t *testing.T) {
+	alphabet := []string{"0", "1", "9", "A", "Z", " ", "$", "a", "~", "é", "点", "茗"}
+	r := rand.New(rand.NewSource(22))
+	for n := 0; n < 300; n++ {
+		var text strings.Builder
+		for i := r.Intn(14) + 1; i > 0; i-- {
+			text.WriteString(alphabet[r.Intn(len(alphabet))])
+		}
+		for _, version := range []int{1, 10, 27} {
+			segments, err := OptimalDataChunks([]byte(text.String()), version)
+			if err != nil {
+				t.Fatalf("%q: %v", text.String(), err)
+			}
+			var joined strings.Builder
+			for _, s := range segments {
+				joined.WriteString(s.String())
+			}
+			if joined.String() != text.String() {
+				t.Fatalf("%q: segments join to %q", text.String(), joined.String())
+			}
+			got, want := segmentsBits(t, segments, version), minimalBits(t, text.String(), version)
+			if got != want {
+				t.Errorf("%q version %d: got %d bits, the shortest encoding takes %d", text.String(), version, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package utils
+
+import "fmt"
+
+// MaxStructuredAppendSymbols is the largest number of symbols a Structured Append sequence can hold.
+const MaxStructuredAppendSymbols = 16
+
+// NewStructuredAppendData creates the Structured Append header of the symbol
+// at position index in a sequence of total symbols.
+func NewStructuredAppendData(index, total, parity int) (*QRData, error) {
+	if total < 1 || total > MaxStructuredAppendSymbols {
+		return nil, fmt.Errorf("invalid structured append symbol count (%d)", total)
+	}
+	if index < 0 || index >= total {
+		return nil, fmt.Errorf("invalid structured append index (%d of %d)", index, total)
+	}
+	if parity < 0 || parity > 0xFF {
+		return nil, fmt.Errorf("invalid structured append parity (%d)", parity)
+	}
+	return &QRData{
+		data: []byte{byte(index), byte(total), byte(parity)},
+		mode: ModeStructuredAppend,
+	}, nil
+}
+
+// StructuredAppendParity returns the parity byte shared by all symbols of a
+// sequence, the XOR of every byte of the original data.
+func StructuredAppendParity(data []byte) int {
+	parity := 0
+	for _, b := range data {
+		parity ^= int(b)
+	}
+	return parity
+}
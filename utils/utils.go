@@ -2,10 +2,10 @@ package utils
 
 import (
 	"fmt"
-	"log"
 	"math"
 	"os"
 	"qrcode/base"
+	"qrcode/constants"
 	"regexp"
 	"strings"
 )
@@ -18,6 +18,33 @@ const (
 	ModeKanji        = 1 << 3
 )
 
+// Mode indicators of segments that carry no character data
+const (
+	ModeStructuredAppend = 0x3
+	ModeFNC1First        = 0x5
+	ModeECI              = 0x7
+	ModeFNC1Second       = 0x9
+)
+
+var modeNames = map[int]string{
+	ModeNumeric:          "numeric",
+	ModeAlphanumeric:     "alphanumeric",
+	ModeByte:             "byte",
+	ModeKanji:            "kanji",
+	ModeStructuredAppend: "structured append",
+	ModeFNC1First:        "fnc1 first",
+	ModeECI:              "eci",
+	ModeFNC1Second:       "fnc1 second",
+}
+
+// ModeName returns the name of a mode, such as "numeric".
+func ModeName(mode int) string {
+	if name, ok := modeNames[mode]; ok {
+		return name
+	}
+	return fmt.Sprintf("mode %d", mode)
+}
+
 // Encoding mode sizes
 var ModeSizeSmall = map[int]int{
 	ModeNumeric:      10,
@@ -135,26 +162,26 @@ func PatternPosition(version int) []int {
 }
 
 // Mask Return the mask function for the given mask pattern.
-func MaskFunc(pattern int) func(int, int) bool {
+func MaskFunc(pattern int) (func(int, int) bool, error) {
 	switch pattern {
 	case 0: // 000
-		return func(i, j int) bool { return (i+j)%2 == 0 }
+		return func(i, j int) bool { return (i+j)%2 == 0 }, nil
 	case 1: // 001
-		return func(i, j int) bool { return i%2 == 0 }
+		return func(i, j int) bool { return i%2 == 0 }, nil
 	case 2: // 010
-		return func(i, j int) bool { return j%3 == 0 }
+		return func(i, j int) bool { return j%3 == 0 }, nil
 	case 3: // 011
-		return func(i, j int) bool { return (i+j)%3 == 0 }
+		return func(i, j int) bool { return (i+j)%3 == 0 }, nil
 	case 4: // 100
-		return func(i, j int) bool { return (i/2+j/3)%2 == 0 }
+		return func(i, j int) bool { return (i/2+j/3)%2 == 0 }, nil
 	case 5: // 101
-		return func(i, j int) bool { return (i*j)%2+(i*j)%3 == 0 }
+		return func(i, j int) bool { return (i*j)%2+(i*j)%3 == 0 }, nil
 	case 6: // 110
-		return func(i, j int) bool { return ((i*j)%2+(i*j)%3)%2 == 0 }
+		return func(i, j int) bool { return ((i*j)%2+(i*j)%3)%2 == 0 }, nil
 	case 7: // 111
-		return func(i, j int) bool { return ((i*j)%3+(i+j)%2)%2 == 0 }
+		return func(i, j int) bool { return ((i*j)%3+(i+j)%2)%2 == 0 }, nil
 	default:
-		panic("Bad mask pattern")
+		return nil, &InvalidMaskPatternError{MaskPattern: pattern}
 	}
 }
 
@@ -180,84 +207,90 @@ func OutIsTTY(out *os.File) bool {
 	return (stat.Mode() & os.ModeCharDevice) != 0
 }
 
-func LostPoint(modules [][]*bool) int {
-	modulesCount := len(modules)
-
-	lostPoint := 0
+func LostPoint(modules *BitMatrix) int {
+	return LostPointScore(modules).Total()
+}
 
-	lostPoint += lostPointLevel1(modules, modulesCount)
-	lostPoint += lostPointLevel2(modules, modulesCount)
-	lostPoint += lostPointLevel3(modules, modulesCount)
-	lostPoint += lostPointLevel4(modules, modulesCount)
+// PenaltyScore holds the mask evaluation penalties of the four rules: N1 for
+// runs of same colored modules, N2 for 2x2 blocks, N3 for finder-like
+// patterns and N4 for the dark module proportion.
+type PenaltyScore struct {
+	N1 int `json:"n1"`
+	N2 int `json:"n2"`
+	N3 int `json:"n3"`
+	N4 int `json:"n4"`
+}
 
-	return lostPoint
+// Total returns the sum of the rule penalties.
+func (p PenaltyScore) Total() int {
+	return p.N1 + p.N2 + p.N3 + p.N4
 }
 
-func lostPointLevel1(modules [][]*bool, modulesCount int) int {
-	lostPoint := 0
-	container := make([]int, modulesCount+1)
+// LostPointScore evaluates the penalty rules for a masked symbol. The rules
+// scan rows and columns alike, so the columns are evaluated on a transposed
+// copy of the modules.
+func LostPointScore(modules *BitMatrix) PenaltyScore {
+	modulesCount := modules.Height()
 
-	for row := 0; row < modulesCount; row++ {
-		thisRow := modules[row]
-		previousColor := thisRow[0]
-		length := 0
-		for col := 0; col < modulesCount; col++ {
-			if thisRow[col] == previousColor {
-				length++
-			} else {
-				if length >= 5 {
-					container[length]++
-				}
-				length = 1
-				previousColor = thisRow[col]
-			}
-		}
-		if length >= 5 {
-			container[length]++
+	rows := make([][]bool, modulesCount)
+	cols := make([][]bool, modulesCount)
+	rowData := make([]bool, modulesCount*modulesCount)
+	colData := make([]bool, modulesCount*modulesCount)
+	for r := 0; r < modulesCount; r++ {
+		rows[r] = rowData[r*modulesCount : (r+1)*modulesCount]
+		cols[r] = colData[r*modulesCount : (r+1)*modulesCount]
+	}
+	for r := 0; r < modulesCount; r++ {
+		for c := 0; c < modulesCount; c++ {
+			dark := modules.Get(r, c)
+			rows[r][c] = dark
+			cols[c][r] = dark
 		}
 	}
 
-	for col := 0; col < modulesCount; col++ {
-		previousColor := modules[0][col]
+	return PenaltyScore{
+		N1: lostPointLevel1(rows) + lostPointLevel1(cols),
+		N2: lostPointLevel2(rows),
+		N3: lostPointLevel3(rows) + lostPointLevel3(cols),
+		N4: lostPointLevel4(modules, modulesCount),
+	}
+}
+
+// lostPointLevel1 scores each run of 5 or more same colored modules as its
+// length minus 2.
+func lostPointLevel1(lines [][]bool) int {
+	lostPoint := 0
+
+	for _, line := range lines {
 		length := 0
-		for row := 0; row < modulesCount; row++ {
-			if modules[row][col] == previousColor {
+		for i, dark := range line {
+			if i > 0 && dark == line[i-1] {
 				length++
-			} else {
-				if length >= 5 {
-					container[length]++
-				}
-				length = 1
-				previousColor = modules[row][col]
+				continue
+			}
+			if length >= 5 {
+				lostPoint += length - 2
 			}
+			length = 1
 		}
 		if length >= 5 {
-			container[length]++
+			lostPoint += length - 2
 		}
 	}
 
-	for eachLength := 5; eachLength <= modulesCount; eachLength++ {
-		lostPoint += container[eachLength] * (eachLength - 2)
-	}
-
 	return lostPoint
 }
 
-func lostPointLevel2(modules [][]*bool, modulesCount int) int {
+// lostPointLevel2 scores each 2x2 block of same colored modules as 3.
+func lostPointLevel2(rows [][]bool) int {
 	lostPoint := 0
 
-	for row := 0; row < modulesCount-1; row++ {
-		thisRow := modules[row]
-		nextRow := modules[row+1]
-		for col := 0; col < modulesCount-1; col++ {
-			topRight := thisRow[col+1]
-			if topRight != nextRow[col+1] {
-				col++ // Skip the next column
-			} else if topRight != thisRow[col] {
-				continue
-			} else if topRight != nextRow[col] {
-				continue
-			} else {
+	for row := 0; row < len(rows)-1; row++ {
+		thisRow := rows[row]
+		nextRow := rows[row+1]
+		for col := 0; col < len(thisRow)-1; col++ {
+			dark := thisRow[col]
+			if thisRow[col+1] == dark && nextRow[col] == dark && nextRow[col+1] == dark {
 				lostPoint += 3
 			}
 		}
@@ -266,92 +299,51 @@ func lostPointLevel2(modules [][]*bool, modulesCount int) int {
 	return lostPoint
 }
 
-func lostPointLevel3(modules [][]*bool, modulesCount int) int {
+// Finder-like patterns for lostPointLevel3: 1:1:3:1:1 dark and light modules
+// with 4 light modules after or before them, oldest module in the high bit.
+const (
+	finderPatternBefore = 0b10111010000
+	finderPatternAfter  = 0b00001011101
+)
+
+// lostPointLevel3 scores each finder-like pattern as 40.
+func lostPointLevel3(lines [][]bool) int {
 	lostPoint := 0
 
-	for row := 0; row < modulesCount; row++ {
-		thisRow := modules[row]
-		for col := 0; col < modulesCount-10; col++ {
-			if !*thisRow[col+1] &&
-				*thisRow[col+4] &&
-				!*thisRow[col+5] &&
-				*thisRow[col+6] &&
-				!*thisRow[col+9] &&
-				((*thisRow[col+0] &&
-					*thisRow[col+2] &&
-					*thisRow[col+3] &&
-					!*thisRow[col+7] &&
-					!*thisRow[col+8] &&
-					!*thisRow[col+10]) ||
-					(!*thisRow[col+0] &&
-						!*thisRow[col+2] &&
-						!*thisRow[col+3] &&
-						*thisRow[col+7] &&
-						*thisRow[col+8] &&
-						*thisRow[col+10])) {
-				lostPoint += 40
+	for _, line := range lines {
+		window := 0
+		for i, dark := range line {
+			window = window << 1 & 0x7ff
+			if dark {
+				window |= 1
 			}
-			if *thisRow[col+10] {
-				col++ // Skip the next column
-			}
-		}
-	}
-
-	for col := 0; col < modulesCount; col++ {
-		for row := 0; row < modulesCount-10; row++ {
-			if !*modules[row+1][col] &&
-				*modules[row+4][col] &&
-				!*modules[row+5][col] &&
-				*modules[row+6][col] &&
-				!*modules[row+9][col] &&
-				((*modules[row+0][col] &&
-					*modules[row+2][col] &&
-					*modules[row+3][col] &&
-					!*modules[row+7][col] &&
-					!*modules[row+8][col] &&
-					!*modules[row+10][col]) ||
-					(!*modules[row+0][col] &&
-						!*modules[row+2][col] &&
-						!*modules[row+3][col] &&
-						*modules[row+7][col] &&
-						*modules[row+8][col] &&
-						*modules[row+10][col])) {
+			if i >= 10 && (window == finderPatternBefore || window == finderPatternAfter) {
 				lostPoint += 40
 			}
-			if *modules[row+10][col] {
-				row++ // Skip the next row
-			}
 		}
 	}
 
 	return lostPoint
 }
 
-func lostPointLevel4(modules [][]*bool, modulesCount int) int {
-	darkCount := 0
-	for _, row := range modules {
-		for _, module := range row {
-			if *module {
-				darkCount++
-			}
-		}
-	}
+func lostPointLevel4(modules *BitMatrix, modulesCount int) int {
+	darkCount := modules.DarkCount()
 
 	percent := float64(darkCount) / float64(modulesCount*modulesCount)
 	rating := int(math.Abs(percent*100-50) / 5)
 	return rating * 10
 }
 
-func LengthInBits(mode int, version int) int {
+func LengthInBits(mode int, version int) (int, error) {
 	if mode != ModeNumeric && mode != ModeAlphanumeric && mode != ModeByte && mode != ModeKanji {
-		panic(fmt.Sprintf("Invalid mode (%d)", mode))
+		return 0, fmt.Errorf("invalid mode (%d)", mode)
 	}
 
 	if !CheckVersion(version) {
-		panic(fmt.Sprintf("Invalid version (%d)", version))
+		return 0, &InvalidVersionError{Version: version}
 	}
 
-	return ModeSizeVersion(version)[mode]
+	return ModeSizeVersion(version)[mode], nil
 }
 
 func Contains(slice []string, item string) bool {
@@ -434,6 +426,7 @@ func BisectLeft(a []int, x int) int {
 type QRData struct {
 	data []byte
 	mode int
+	eci  int
 }
 
 // NewQRData creates a new QRData instance.
@@ -445,12 +438,23 @@ func NewQRData(data []byte, mode int, checkData bool) (*QRData, error) {
 	if mode == 0 {
 		mode = OptimalMode(data)
 	} else {
-		if mode != ModeNumeric && mode != ModeAlphanumeric && mode != ModeByte {
+		if mode != ModeNumeric && mode != ModeAlphanumeric && mode != ModeByte && mode != ModeKanji {
 			return nil, fmt.Errorf("invalid mode (%d)", mode)
 		}
-		if checkData && mode < OptimalMode(data) {
+		if checkData && !fitsMode(data, mode) {
+			return nil, fmt.Errorf("provided data cannot be represented in mode %d", mode)
+		}
+	}
+
+	if mode == ModeKanji {
+		sjis, err := ToShiftJIS(data)
+		if err != nil {
+			return nil, err
+		}
+		if !isShiftJISKanji(sjis) {
 			return nil, fmt.Errorf("provided data cannot be represented in mode %d", mode)
 		}
+		data = sjis
 	}
 
 	return &QRData{
@@ -459,8 +463,11 @@ func NewQRData(data []byte, mode int, checkData bool) (*QRData, error) {
 	}, nil
 }
 
-// Len returns the length of the data.
+// Len returns the length of the data in characters.
 func (q *QRData) Len() int {
+	if q.mode == ModeKanji {
+		return len(q.data) / 2
+	}
 	return len(q.data)
 }
 
@@ -468,9 +475,43 @@ func (q *QRData) GetMode() int {
 	return q.mode
 }
 
+// WriteSegment writes the mode indicator, the character count and the data to the buffer.
+func (q *QRData) WriteSegment(buffer *BitBuffer, version int) error {
+	buffer.Put(q.mode, 4)
+	if q.hasCharacterCount() {
+		length, err := LengthInBits(q.mode, version)
+		if err != nil {
+			return err
+		}
+		buffer.Put(q.Len(), length)
+	}
+	q.Write(buffer)
+	return nil
+}
+
+// hasCharacterCount reports whether the segment carries a character count indicator.
+func (q *QRData) hasCharacterCount() bool {
+	switch q.mode {
+	case ModeECI, ModeStructuredAppend, ModeFNC1First, ModeFNC1Second:
+		return false
+	default:
+		return true
+	}
+}
+
 // Write writes the data to the buffer.
 func (q *QRData) Write(buffer *BitBuffer) {
-	if q.mode == ModeNumeric {
+	if q.mode == ModeECI {
+		q.writeECI(buffer)
+	} else if q.mode == ModeStructuredAppend {
+		buffer.Put(int(q.data[0]), 4)
+		buffer.Put(int(q.data[1])-1, 4)
+		buffer.Put(int(q.data[2]), 8)
+	} else if q.mode == ModeFNC1First {
+		return
+	} else if q.mode == ModeFNC1Second {
+		buffer.Put(int(q.data[0]), 8)
+	} else if q.mode == ModeNumeric {
 		for i := 0; i < len(q.data); i += 3 {
 			chars := q.data[i:min(i+3, len(q.data))]
 			bitLength := NumberLength[len(chars)]
@@ -486,6 +527,10 @@ func (q *QRData) Write(buffer *BitBuffer) {
 				buffer.Put(alphanumericIndex(chars[0]), 6)
 			}
 		}
+	} else if q.mode == ModeKanji {
+		for i := 0; i+1 < len(q.data); i += 2 {
+			buffer.Put(kanjiValue(int(q.data[i])<<8|int(q.data[i+1])), 13)
+		}
 	} else {
 		for _, c := range q.data {
 			buffer.Put(int(c), 8)
@@ -495,6 +540,11 @@ func (q *QRData) Write(buffer *BitBuffer) {
 
 // String returns a string representation of the QRData.
 func (q *QRData) String() string {
+	if q.mode == ModeKanji {
+		if decoded, err := FromShiftJIS(q.data); err == nil {
+			return string(decoded)
+		}
+	}
 	return string(q.data)
 }
 
@@ -506,9 +556,26 @@ func OptimalMode(data []byte) int {
 	if ReAlphaNumeric.Match(data) {
 		return ModeAlphanumeric
 	}
+	if IsKanji(data) {
+		return ModeKanji
+	}
 	return ModeByte
 }
 
+// fitsMode reports whether data can be represented in the given mode.
+func fitsMode(data []byte, mode int) bool {
+	switch mode {
+	case ModeNumeric:
+		return isDigit(data)
+	case ModeAlphanumeric:
+		return ReAlphaNumeric.Match(data)
+	case ModeKanji:
+		return IsKanji(data)
+	default:
+		return true
+	}
+}
+
 func isDigit(data []byte) bool {
 	for _, b := range data {
 		if b < '0' || b > '9' {
@@ -552,63 +619,16 @@ func bytesToInt(bytes []byte) int {
 	return result
 }
 
-// OptimalDataChunks returns an iterator of QRData chunks optimized to the data content.
-func OptimalDataChunks(data []byte, minimum int) ([]*QRData, error) {
-	if minimum <= 0 {
-		minimum = 4
-	}
-	data = toBytes(data)
-	numPattern := regexp.MustCompile(`\d`)
-	alphaPattern := regexp.MustCompile("[" + regexp.QuoteMeta(AlphanumericChars) + "]")
-	if len(data) <= minimum {
-		numPattern = regexp.MustCompile(`^\d+$`)
-		alphaPattern = regexp.MustCompile("^[" + regexp.QuoteMeta(AlphanumericChars) + "]+$")
-	} else {
-		repeat := fmt.Sprintf("{%d,}", minimum)
-		numPattern = regexp.MustCompile(`\d` + repeat)
-		alphaPattern = regexp.MustCompile("[" + regexp.QuoteMeta(AlphanumericChars) + "]" + repeat)
-	}
-	return optimalSplit(data, numPattern, alphaPattern)
-}
-
-func optimalSplit(data []byte, numPattern, alphaPattern *regexp.Regexp) ([]*QRData, error) {
-	var result []*QRData
-	for len(data) > 0 {
-		numMatch := numPattern.FindIndex(data)
-		if numMatch == nil {
-			break
-		}
-		start, end := numMatch[0], numMatch[1]
-		if start > 0 {
-			result = append(result, &QRData{data: data[:start], mode: ModeByte})
-		}
-		result = append(result, &QRData{data: data[start:end], mode: ModeNumeric})
-		data = data[end:]
-	}
-	if len(data) > 0 {
-		alphaMatch := alphaPattern.FindIndex(data)
-		if alphaMatch != nil {
-			start, end := alphaMatch[0], alphaMatch[1]
-			if start > 0 {
-				result = append(result, &QRData{data: data[:start], mode: ModeByte})
-			}
-			result = append(result, &QRData{data: data[start:end], mode: ModeAlphanumeric})
-			data = data[end:]
-		} else {
-			result = append(result, &QRData{data: data, mode: ModeByte})
-		}
-	}
-	return result, nil
-}
-
-func CreateBytes(buffer *BitBuffer, rsBlocks []base.RSBlock) []byte {
+// CreateBytes splits the data codewords in buffer into the RS blocks, adds
+// their error correction codewords and returns all codewords interleaved.
+func CreateBytes(buffer *BitBuffer, rsBlocks []base.RSBlock) ([]byte, error) {
 	offset := 0
 
 	maxDcCount := 0
 	maxEcCount := 0
 
-	dcdata := make([][]int, len(rsBlocks))
-	ecdata := make([][]int, len(rsBlocks))
+	dcdata := make([][]byte, len(rsBlocks))
+	ecdata := make([][]byte, len(rsBlocks))
 
 	for r := 0; r < len(rsBlocks); r++ {
 		rsBlock := rsBlocks[r]
@@ -622,54 +642,20 @@ func CreateBytes(buffer *BitBuffer, rsBlocks []base.RSBlock) []byte {
 			maxEcCount = ecCount
 		}
 
-		dcdata[r] = make([]int, dcCount)
+		if offset+dcCount > len(buffer.buffer) {
+			return nil, fmt.Errorf("not enough data codewords (%d) for the RS blocks", len(buffer.buffer))
+		}
+		dcdata[r] = make([]byte, dcCount)
 		for i := 0; i < len(dcdata[r]); i++ {
-			dcdata[r][i] = 0xff & buffer.buffer[i+offset]
+			dcdata[r][i] = byte(buffer.buffer[i+offset])
 		}
 		offset += dcCount
 
-		// Get error correction polynomial.
-		rsPoly, err := base.NewPolynomial([]int{1}, 0)
+		ec, err := base.RSEncode(dcdata[r], ecCount)
 		if err != nil {
-			log.Printf("Failed to create polynomial: %v", err)
-			return nil
-		}
-
-		for i := 0; i < ecCount; i++ {
-			child, err := base.NewPolynomial([]int{1, base.Gexp(i)}, 0)
-			if err != nil {
-				log.Printf("Failed to create polynomial: %v", err)
-				return nil
-			}
-			rsPoly, err = rsPoly.Mul(child)
-			if err != nil {
-				log.Printf("Failed to multiply polynomials: %v", err)
-				return nil
-			}
-		}
-
-		rawPoly, err := base.NewPolynomial(dcdata[r], rsPoly.Len()-1)
-		if err != nil {
-			log.Printf("Failed to create raw polynomial: %v", err)
-			return nil
-		}
-
-		modPoly, err := rawPoly.Mod(rsPoly)
-		if err != nil {
-			log.Printf("Failed to mod polynomial: %v", err)
-			return nil
-		}
-
-		ecdata[r] = make([]int, rsPoly.Len()-1)
-		modOffset := modPoly.Len() - len(ecdata[r])
-		for i := 0; i < len(ecdata[r]); i++ {
-			modIndex := i + modOffset
-			if modIndex >= 0 {
-				ecdata[r][i] = modPoly.Get(modIndex)
-			} else {
-				ecdata[r][i] = 0
-			}
+			return nil, err
 		}
+		ecdata[r] = ec
 	}
 
 	totalCodewords := 0
@@ -683,7 +669,7 @@ func CreateBytes(buffer *BitBuffer, rsBlocks []base.RSBlock) []byte {
 	for i := 0; i < maxDcCount; i++ {
 		for r := 0; r < len(rsBlocks); r++ {
 			if i < len(dcdata[r]) {
-				data[index] = byte(dcdata[r][i])
+				data[index] = dcdata[r][i]
 				index++
 			}
 		}
@@ -692,21 +678,21 @@ func CreateBytes(buffer *BitBuffer, rsBlocks []base.RSBlock) []byte {
 	for i := 0; i < maxEcCount; i++ {
 		for r := 0; r < len(rsBlocks); r++ {
 			if i < len(ecdata[r]) {
-				data[index] = byte(ecdata[r][i])
+				data[index] = ecdata[r][i]
 				index++
 			}
 		}
 	}
 
-	return data
+	return data, nil
 }
 
-func CreateData(version int, errorCorrection int, dataList []*QRData) ([]byte, error) {
+func CreateData(version int, errorCorrection constants.ErrorCorrectionLevel, dataList []*QRData) ([]byte, error) {
 	buffer := NewBitBuffer()
 	for _, data := range dataList {
-		buffer.Put(data.mode, 4)
-		buffer.Put(len(data.data), LengthInBits(data.mode, version))
-		data.Write(buffer)
+		if err := data.WriteSegment(buffer, version); err != nil {
+			return nil, err
+		}
 	}
 
 	// Calculate the maximum number of bits for the given version.
@@ -720,7 +706,7 @@ func CreateData(version int, errorCorrection int, dataList []*QRData) ([]byte, e
 		bitLimit += block.DataCount * 8
 	}
 	if buffer.Len() > bitLimit {
-		return nil, fmt.Errorf("code length overflow. Data size (%d) > size available (%d)", buffer.Len(), bitLimit)
+		return nil, NewDataOverflowError(buffer.Len(), bitLimit)
 	}
 
 	// Terminate the bits (add up to four 0s).
@@ -746,5 +732,5 @@ func CreateData(version int, errorCorrection int, dataList []*QRData) ([]byte, e
 		}
 	}
 
-	return CreateBytes(buffer, rsBlocks), nil
+	return CreateBytes(buffer, rsBlocks)
 }